@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the configuration of the SCIM server. Each field is set by the command line flag of its flag tag, or the
+// environment variable of its env tag if the flag is not given, or the value of its default tag.
+type Config struct {
+	Addr             string        `flag:"addr" env:"SCIM_ADDR" default:":8080" usage:"Address the HTTP server listens on"`
+	LogLevel         string        `flag:"log-level" env:"SCIM_LOG_LEVEL" default:"debug" usage:"Log level, one of panic, fatal, error, warn, info, debug or trace"`
+	RedactAttributes string        `flag:"redact-attributes" env:"SCIM_REDACT_ATTRIBUTES" default:"password" usage:"Comma separated attributes whose values are masked in logged request and response bodies"`
+	LogFormat        string        `flag:"log-format" env:"SCIM_LOG_FORMAT" default:"text" usage:"Log format, one of text or json"`
+	LogResponses     bool          `flag:"log-responses" env:"SCIM_LOG_RESPONSES" usage:"Log response bodies at trace level, requires --log-level trace"`
+	Store            string        `flag:"store" env:"SCIM_STORE" default:"memory" usage:"Store for provisioned resources, one of memory, sqlite or postgres"`
+	DBPath           string        `flag:"db" env:"SCIM_DB" default:"users.db" usage:"Path of the SQLite database used by --store sqlite"`
+	DSN              string        `flag:"dsn" env:"SCIM_DSN" usage:"Data source name of the PostgreSQL database used by --store postgres"`
+	ShutdownTimeout  time.Duration `flag:"shutdown-timeout" env:"SCIM_SHUTDOWN_TIMEOUT" default:"10s" usage:"Time to wait for in-flight requests on shutdown"`
+	Token            string        `flag:"token" env:"SCIM_TOKEN" usage:"Bearer token clients must present"`
+	TokenUser        string        `flag:"token-user" env:"SCIM_TOKEN_USER" usage:"Id of the user that /Me resolves to for requests authenticated with --token"`
+	TLSCert          string        `flag:"tls-cert" env:"SCIM_TLS_CERT" usage:"Path of the TLS certificate, the server uses HTTPS when set together with --tls-key"`
+	TLSKey           string        `flag:"tls-key" env:"SCIM_TLS_KEY" usage:"Path of the TLS private key, reloaded with the certificate on SIGHUP"`
+	MaxResults       int           `flag:"max-results" env:"SCIM_MAX_RESULTS" default:"200" usage:"Maximum number of resources returned in a list response"`
+	BulkConcurrency  int           `flag:"bulk-concurrency" env:"SCIM_BULK_CONCURRENCY" default:"4" usage:"Maximum number of operations of a bulk request processed at the same time"`
+	MaxFilterLength  int           `flag:"max-filter-length" env:"SCIM_MAX_FILTER_LENGTH" default:"4096" usage:"Maximum length of filters in bytes, longer filters are rejected with 400"`
+	MaxPatchOps      int           `flag:"max-patch-operations" env:"SCIM_MAX_PATCH_OPERATIONS" default:"1000" usage:"Maximum number of operations of a PATCH request, larger requests are rejected with 400"`
+	MaxBodySize      int           `flag:"max-body-size" env:"SCIM_MAX_BODY_SIZE" default:"1048576" usage:"Maximum size of request bodies in bytes, larger requests are rejected with 413"`
+	CORSOrigins      string        `flag:"cors-origins" env:"SCIM_CORS_ORIGINS" usage:"Comma separated origins allowed to call the API from a browser, * allows any, CORS is disabled when empty"`
+	BaseURL          string        `flag:"base-url" env:"SCIM_BASE_URL" usage:"External URL of the SCIM endpoint, e.g. https://example.com/scim/v2, meta.location is relative to it"`
+	UpsertOnPut      bool          `flag:"upsert-on-put" env:"SCIM_UPSERT_ON_PUT" usage:"Create resources replaced with PUT that don't exist instead of returning 404"`
+	IdempotentDelete bool          `flag:"idempotent-delete" env:"SCIM_IDEMPOTENT_DELETE" usage:"Respond 204 to deletes of resources that don't exist instead of 404"`
+	DefaultActive    bool          `flag:"default-active" env:"SCIM_DEFAULT_ACTIVE" default:"true" usage:"Make users created without the active attribute active"`
+	WeakETags        bool          `flag:"weak-etags" env:"SCIM_WEAK_ETAGS" usage:"Report resource versions as weak ETags with the W/ prefix instead of strong ones, for clients behind proxies that weaken them"`
+	StrictAttributes bool          `flag:"strict-attributes" env:"SCIM_STRICT_ATTRIBUTES" usage:"Reject creates with attributes that are not declared in the schema"`
+	CheckSchemas     bool          `flag:"check-schemas" env:"SCIM_CHECK_SCHEMAS" default:"true" usage:"Reject creates and replaces whose schemas attribute lacks the schema of the resource type or of extensions with attributes present"`
+	Tracing          string        `flag:"tracing" env:"SCIM_TRACING" default:"none" usage:"Exporter of OpenTelemetry spans, one of none or stdout"`
+	RateLimit        float64       `flag:"rate-limit" env:"SCIM_RATE_LIMIT" usage:"Requests per second allowed to the SCIM API, rate limiting is disabled when 0"`
+	RateBurst        int           `flag:"rate-burst" env:"SCIM_RATE_BURST" default:"20" usage:"Number of requests allowed to exceed --rate-limit at once"`
+	RateLimitBy      string        `flag:"rate-limit-by" env:"SCIM_RATE_LIMIT_BY" default:"global" usage:"Whether --rate-limit applies to all requests or per client, one of global or ip"`
+	SeedPath         string        `flag:"seed" env:"SCIM_SEED" usage:"Path of a JSON file with Users and Groups lists to load on startup"`
+	ReadOnly         bool          `flag:"read-only" env:"SCIM_READ_ONLY" usage:"Reject creating, replacing, patching and deleting resources with 501, e.g. to serve seeded resources"`
+	SoftDelete       bool          `flag:"soft-delete" env:"SCIM_SOFT_DELETE" usage:"Keep deleted resources so they can be restored with POST /admin/undelete/{resourceType}/{id}"`
+	Pretty           bool          `flag:"pretty" env:"SCIM_PRETTY" usage:"Indent JSON responses, e.g. for reading curl output"`
+	EnableReset      bool          `flag:"enable-reset" env:"SCIM_ENABLE_RESET" usage:"Expose POST /admin/reset to delete all resources, for tests only"`
+	EnableAudit      bool          `flag:"enable-audit" env:"SCIM_ENABLE_AUDIT" usage:"Record every change to resources in memory and expose the audit log at GET /admin/audit"`
+	EnableDump       bool          `flag:"enable-dump" env:"SCIM_ENABLE_DUMP" usage:"Expose GET /admin/dump to stream all resources as newline delimited JSON, e.g. for backups"`
+}
+
+// loadConfig defines the flags of Config in fs, parses args and returns the validated configuration. getenv looks up
+// the environment variables, e.g. os.Getenv.
+func loadConfig(fs *flag.FlagSet, args []string, getenv func(string) string) (Config, error) {
+	var cfg Config
+	v := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, env := field.Tag.Get("flag"), field.Tag.Get("env")
+		usage := fmt.Sprintf("%s [$%s]", field.Tag.Get("usage"), env)
+
+		switch p := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			fs.StringVar(p, name, "", usage)
+		case *bool:
+			fs.BoolVar(p, name, false, usage)
+		case *int:
+			fs.IntVar(p, name, 0, usage)
+		case *float64:
+			fs.Float64Var(p, name, 0, usage)
+		case *time.Duration:
+			fs.DurationVar(p, name, 0, usage)
+		default:
+			return Config{}, fmt.Errorf("unsupported type %s of config field %s", field.Type, field.Name)
+		}
+
+		value, source := field.Tag.Get("default"), "default"
+		if s := getenv(env); s != "" {
+			value, source = s, "$"+env
+		}
+		if value == "" {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q of --%s: %w", source, value, name, err)
+		}
+		fs.Lookup(name).DefValue = value
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.validate()
+}
+
+// validate returns an error describing the first invalid value or combination of values of cfg.
+func (cfg Config) validate() error {
+	if _, err := logrus.ParseLevel(cfg.LogLevel); err != nil {
+		return fmt.Errorf("invalid --log-level %q, expected one of panic, fatal, error, warn, info, debug or trace", cfg.LogLevel)
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("invalid --log-format %q, expected text or json", cfg.LogFormat)
+	}
+	switch cfg.Store {
+	case "memory", "sqlite":
+	case "postgres":
+		if cfg.DSN == "" {
+			return fmt.Errorf("--store postgres requires --dsn")
+		}
+	default:
+		return fmt.Errorf("invalid --store %q, expected memory, sqlite or postgres", cfg.Store)
+	}
+	if cfg.MaxResults < 1 {
+		return fmt.Errorf("invalid --max-results %d, expected a positive number", cfg.MaxResults)
+	}
+	if cfg.BulkConcurrency < 1 {
+		return fmt.Errorf("invalid --bulk-concurrency %d, expected a positive number", cfg.BulkConcurrency)
+	}
+	if cfg.MaxFilterLength < 1 {
+		return fmt.Errorf("invalid --max-filter-length %d, expected a positive number", cfg.MaxFilterLength)
+	}
+	if cfg.MaxPatchOps < 1 {
+		return fmt.Errorf("invalid --max-patch-operations %d, expected a positive number", cfg.MaxPatchOps)
+	}
+	if cfg.MaxBodySize < 1 {
+		return fmt.Errorf("invalid --max-body-size %d, expected a positive number", cfg.MaxBodySize)
+	}
+	if u, err := url.Parse(cfg.BaseURL); cfg.BaseURL != "" && (err != nil || !u.IsAbs() || u.Host == "") {
+		return fmt.Errorf("invalid --base-url %q, expected an absolute URL", cfg.BaseURL)
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("both --tls-cert and --tls-key are required to serve HTTPS")
+	}
+	if cfg.TokenUser != "" && cfg.Token == "" {
+		return fmt.Errorf("--token-user requires --token")
+	}
+	if cfg.Tracing != "none" && cfg.Tracing != "stdout" {
+		return fmt.Errorf("invalid --tracing %q, expected none or stdout", cfg.Tracing)
+	}
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("invalid --rate-limit %v, expected a positive number or 0", cfg.RateLimit)
+	}
+	if cfg.RateLimit > 0 && cfg.RateBurst < 1 {
+		return fmt.Errorf("invalid --rate-burst %d, expected a positive number", cfg.RateBurst)
+	}
+	if cfg.RateLimitBy != "global" && cfg.RateLimitBy != "ip" {
+		return fmt.Errorf("invalid --rate-limit-by %q, expected global or ip", cfg.RateLimitBy)
+	}
+	if cfg.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid --shutdown-timeout %s, expected a positive duration", cfg.ShutdownTimeout)
+	}
+	return nil
+}
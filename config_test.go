@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFlags(t *testing.T) {
+	cfg := testConfig(t)
+	if cfg.Addr != ":8080" || cfg.LogLevel != "debug" {
+		t.Errorf("defaults: got addr %q and log level %q, want :8080 and debug", cfg.Addr, cfg.LogLevel)
+	}
+
+	cfg = testConfig(t, "-addr", "127.0.0.1:9090", "-log-level", "warn")
+	if cfg.Addr != "127.0.0.1:9090" || cfg.LogLevel != "warn" {
+		t.Errorf("flags: got addr %q and log level %q, want 127.0.0.1:9090 and warn", cfg.Addr, cfg.LogLevel)
+	}
+}
+
+// loadTestConfig loads the configuration of args and the environment variables of env.
+func loadTestConfig(args []string, env map[string]string) (Config, error) {
+	fs := flag.NewFlagSet("scim", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return loadConfig(fs, args, func(key string) string { return env[key] })
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	env := map[string]string{
+		"SCIM_ADDR":             ":9000",
+		"SCIM_MAX_RESULTS":      "50",
+		"SCIM_UPSERT_ON_PUT":    "true",
+		"SCIM_SHUTDOWN_TIMEOUT": "30s",
+		"SCIM_RATE_LIMIT":       "2.5",
+		"SCIM_DEFAULT_ACTIVE":   "false",
+	}
+	cfg, err := loadTestConfig(nil, env)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Addr != ":9000" || cfg.MaxResults != 50 || !cfg.UpsertOnPut || cfg.ShutdownTimeout != 30*time.Second || cfg.RateLimit != 2.5 || cfg.DefaultActive {
+		t.Errorf("env: got %+v", cfg)
+	}
+	// unset variables keep their defaults
+	if cfg.Store != "memory" || cfg.BulkConcurrency != 4 || !cfg.CheckSchemas {
+		t.Errorf("env: got store %q, bulk concurrency %d and check schemas %v, want the defaults", cfg.Store, cfg.BulkConcurrency, cfg.CheckSchemas)
+	}
+
+	// flags take precedence over the environment
+	cfg, err = loadTestConfig([]string{"-addr", ":9001", "-default-active"}, env)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Addr != ":9001" || !cfg.DefaultActive || cfg.MaxResults != 50 {
+		t.Errorf("flags and env: got addr %q, default active %v and max results %d, want :9001, true and 50", cfg.Addr, cfg.DefaultActive, cfg.MaxResults)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{"malformed env", nil, map[string]string{"SCIM_MAX_RESULTS": "many"}, "$SCIM_MAX_RESULTS"},
+		{"malformed flag", []string{"-shutdown-timeout", "soon"}, nil, "shutdown-timeout"},
+		{"unknown flag", []string{"-colour"}, nil, "colour"},
+		{"log level", []string{"-log-level", "verbose"}, nil, "--log-level"},
+		{"store", []string{"-store", "mysql"}, nil, "--store"},
+		{"postgres without dsn", []string{"-store", "postgres"}, nil, "--dsn"},
+		{"max results", []string{"-max-results", "0"}, nil, "--max-results"},
+		{"relative base url", []string{"-base-url", "/scim/v2"}, nil, "--base-url"},
+		{"tls cert without key", []string{"-tls-cert", "tls.crt"}, nil, "--tls-key"},
+		{"tls key without cert", nil, map[string]string{"SCIM_TLS_KEY": "tls.key"}, "--tls-cert"},
+		{"token user without token", []string{"-token-user", "2819c223"}, nil, "--token"},
+		{"negative rate limit", []string{"-rate-limit", "-1"}, nil, "--rate-limit"},
+		{"rate limit without burst", []string{"-rate-limit", "10", "-rate-burst", "0"}, nil, "--rate-burst"},
+		{"rate limit key", []string{"-rate-limit-by", "user"}, nil, "--rate-limit-by"},
+		{"tracing", []string{"-tracing", "jaeger"}, nil, "--tracing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTestConfig(test.args, test.env)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one mentioning %s", err, test.wantErr)
+			}
+		})
+	}
+}
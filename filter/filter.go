@@ -0,0 +1,370 @@
+// Package filter parses and evaluates SCIM filters as defined in RFC 7644, section 3.4.2.2.
+package filter
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operator is a SCIM filter attribute operator.
+type Operator string
+
+const (
+	Equal              Operator = "eq"
+	NotEqual           Operator = "ne"
+	Contains           Operator = "co"
+	StartsWith         Operator = "sw"
+	EndsWith           Operator = "ew"
+	Present            Operator = "pr"
+	GreaterThan        Operator = "gt"
+	GreaterThanOrEqual Operator = "ge"
+	LessThan           Operator = "lt"
+	LessThanOrEqual    Operator = "le"
+)
+
+func (o Operator) valid() bool {
+	switch o {
+	case Equal, NotEqual, Contains, StartsWith, EndsWith, Present,
+		GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual:
+		return true
+	}
+	return false
+}
+
+// Expression is a parsed filter that can be evaluated against the attributes of a resource.
+type Expression interface {
+	// Matches reports whether the given resource attributes satisfy the expression.
+	Matches(attributes map[string]interface{}) bool
+}
+
+// LogicalOperator joins two expressions.
+type LogicalOperator string
+
+const (
+	And LogicalOperator = "and"
+	Or  LogicalOperator = "or"
+)
+
+// LogicalExpression combines two expressions with "and" or "or".
+type LogicalExpression struct {
+	Operator    LogicalOperator
+	Left, Right Expression
+}
+
+func (e *LogicalExpression) Matches(attributes map[string]interface{}) bool {
+	if e.Operator == And {
+		return e.Left.Matches(attributes) && e.Right.Matches(attributes)
+	}
+	return e.Left.Matches(attributes) || e.Right.Matches(attributes)
+}
+
+// NotExpression negates an expression, e.g. `not (userName eq "bjensen")`.
+type NotExpression struct {
+	Expression Expression
+}
+
+func (e *NotExpression) Matches(attributes map[string]interface{}) bool {
+	return !e.Expression.Matches(attributes)
+}
+
+// ValuePathExpression matches if an element of a multi-valued complex attribute, or a singular complex attribute,
+// matches the filter, e.g. `emails[type eq "work" and value co "@example.com"]`. Unlike
+// `emails.type eq "work" and emails.value co "@example.com"` both comparisons must hold for the same email.
+type ValuePathExpression struct {
+	AttributePath string
+	// Filter is evaluated against the sub-attributes of each element.
+	Filter Expression
+}
+
+func (e *ValuePathExpression) Matches(attributes map[string]interface{}) bool {
+	value, ok := Lookup(attributes, e.AttributePath)
+	if !ok {
+		return false
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if element, ok := v.(map[string]interface{}); ok && e.Filter.Matches(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttributeExpression compares the value of an attribute, e.g. `userName eq "bjensen"` or `title pr`.
+type AttributeExpression struct {
+	AttributePath string
+	Operator      Operator
+	// Value is a string, json.Number, bool or nil. It is nil for the Present operator.
+	Value interface{}
+	// CaseExact makes string comparisons case-sensitive, strings are compared case-insensitively by default like the
+	// values of attributes whose caseExact characteristic is false, see RFC 7644, section 3.4.2.2.
+	CaseExact bool
+}
+
+// Matches evaluates the comparison against the value of the attribute. The value of a multi-valued attribute matches if
+// any of its values does, e.g. `emails.value eq "bjensen@example.com"`, a complex value is compared by its "value"
+// sub-attribute, e.g. `members eq "2819c223"`.
+func (e *AttributeExpression) Matches(attributes map[string]interface{}) bool {
+	value, ok := Lookup(attributes, e.AttributePath)
+
+	switch e.Operator {
+	case Present:
+		return ok && present(value)
+	case NotEqual:
+		return !ok || !e.matchesAny(value, Equal)
+	}
+	if !ok {
+		return false
+	}
+	return e.matchesAny(value, e.Operator)
+}
+
+// matchesAny reports whether value, or any of the values of a multi-valued attribute, matches the comparison with the
+// given operator.
+func (e *AttributeExpression) matchesAny(value interface{}, operator Operator) bool {
+	values, ok := value.([]interface{})
+	if !ok {
+		return e.matches(value, operator)
+	}
+	for _, v := range values {
+		if m, isComplex := v.(map[string]interface{}); isComplex {
+			if v, ok = field(m, "value"); !ok {
+				continue
+			}
+		}
+		if e.matches(v, operator) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the single value matches the comparison with the given operator.
+func (e *AttributeExpression) matches(value interface{}, operator Operator) bool {
+	switch operator {
+	case Equal:
+		return equal(value, e.Value, e.CaseExact)
+	case Contains, StartsWith, EndsWith:
+		s, sOk := value.(string)
+		v, vOk := e.Value.(string)
+		if !sOk || !vOk {
+			return false
+		}
+		if !e.CaseExact {
+			s, v = strings.ToLower(s), strings.ToLower(v)
+		}
+		switch operator {
+		case Contains:
+			return strings.Contains(s, v)
+		case StartsWith:
+			return strings.HasPrefix(s, v)
+		default:
+			return strings.HasSuffix(s, v)
+		}
+	default:
+		c, ok := compare(value, e.Value, e.CaseExact)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case GreaterThan:
+			return c > 0
+		case GreaterThanOrEqual:
+			return c >= 0
+		case LessThan:
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+}
+
+// present reports whether value is non-empty, a complex value is present if any of its sub-attributes is, see RFC 7644,
+// section 3.4.2.2.
+func present(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []interface{}:
+		for _, e := range v {
+			if present(e) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		for _, e := range v {
+			if present(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Lookup resolves an attribute path such as "name.givenName", "emails.value" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department".
+func Lookup(attributes map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = attributes
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		i := strings.LastIndex(path, ":")
+		if extension, ok := field(attributes, path[:i]); ok {
+			current = extension
+		}
+		path = path[i+1:]
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		var ok bool
+		if current, ok = subAttribute(current, name); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// subAttribute returns the named sub-attribute of a complex value, or the list of the sub-attributes of the elements
+// of a multi-valued complex attribute that have it, e.g. the values of "emails.value".
+func subAttribute(v interface{}, name string) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return field(v, name)
+	case []interface{}:
+		var values []interface{}
+		for _, e := range v {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if value, ok := field(m, name); ok {
+				values = append(values, value)
+			}
+		}
+		return values, len(values) > 0
+	}
+	return nil, false
+}
+
+// field returns the value of the named attribute, attribute names are case-insensitive.
+func field(m map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func equal(value, literal interface{}, caseExact bool) bool {
+	if c, ok := compare(value, literal, caseExact); ok {
+		return c == 0
+	}
+	value, literal = coerce(value, literal)
+	return value == literal
+}
+
+// coerce converts a boolean or number stored or given as a string to the type of the other value, e.g. so
+// `active eq true` matches clients that send `"active": "True"`.
+func coerce(value, literal interface{}) (interface{}, interface{}) {
+	switch v := value.(type) {
+	case string:
+		switch literal.(type) {
+		case bool:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, literal
+			}
+		case json.Number:
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return json.Number(v), literal
+			}
+		}
+	case bool:
+		if l, ok := literal.(string); ok {
+			if b, err := strconv.ParseBool(l); err == nil {
+				return value, b
+			}
+		}
+	default:
+		if l, ok := literal.(string); ok {
+			if _, isNumber := number(value); isNumber {
+				if _, err := strconv.ParseFloat(l, 64); err == nil {
+					return value, json.Number(l)
+				}
+			}
+		}
+	}
+	return value, literal
+}
+
+// compare orders two strings or two numbers, ok is false if the values are not comparable. Strings that are both
+// RFC 3339 timestamps, e.g. meta.lastModified, are compared as times so different offsets and precisions order
+// correctly, other strings are compared case-insensitively unless caseExact is set.
+func compare(value, literal interface{}, caseExact bool) (int, bool) {
+	value, literal = coerce(value, literal)
+	if s, ok := value.(string); ok {
+		l, ok := literal.(string)
+		if !ok {
+			return 0, false
+		}
+		if c, ok := compareTimes(s, l); ok {
+			return c, true
+		}
+		if !caseExact {
+			s, l = strings.ToLower(s), strings.ToLower(l)
+		}
+		return strings.Compare(s, l), true
+	}
+
+	a, aOk := number(value)
+	b, bOk := number(literal)
+	if !aOk || !bOk {
+		return 0, false
+	}
+	switch {
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	}
+	return 0, true
+}
+
+// compareTimes orders two RFC 3339 timestamps, ok is false if either is not one.
+func compareTimes(value, literal string) (int, bool) {
+	a, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, false
+	}
+	b, err := time.Parse(time.RFC3339Nano, literal)
+	if err != nil {
+		return 0, false
+	}
+	return a.Compare(b), true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
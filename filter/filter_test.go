@@ -0,0 +1,186 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testUser returns the attributes of a user the filter tests are evaluated against.
+func testUser() map[string]interface{} {
+	return map[string]interface{}{
+		"userName":    "bjensen",
+		"displayName": "Barbara Jane Jensen",
+		"title":       "Tour Guide",
+		"nickName":    "",
+		"loginCount":  json.Number("42"),
+		"name": map[string]interface{}{
+			"givenName":  "Barbara",
+			"familyName": "Jensen",
+		},
+	}
+}
+
+func TestParseOperators(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`userName eq "BJensen"`, true},
+		{`userName eq "jsmith"`, false},
+		{`userName ne "jsmith"`, true},
+		{`userName ne "bjensen"`, false},
+		{`displayName eq "Barbara Jane Jensen"`, true},
+		{`displayName co "Jane Jen"`, true},
+		{`displayName co "John"`, false},
+		{`displayName sw "Barbara Jane"`, true},
+		{`displayName sw "Jane"`, false},
+		{`displayName ew "Jane Jensen"`, true},
+		{`displayName ew "Barbara"`, false},
+		{`title pr`, true},
+		{`nickName pr`, false},
+		{`manager pr`, false},
+		{`loginCount gt 41`, true},
+		{`loginCount gt 42`, false},
+		{`loginCount ge 42`, true},
+		{`loginCount lt 43`, true},
+		{`loginCount lt 42`, false},
+		{`loginCount le 42`, true},
+		{`userName gt "a"`, true},
+		{`userName lt "a"`, false},
+		{`name.givenName eq "Barbara"`, true},
+		{`title eq "Tour \"Guide\""`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			expr, err := Parse(test.filter)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := expr.Matches(testUser()); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQuotedValues(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   interface{}
+	}{
+		{`displayName eq "Barbara Jane Jensen"`, "Barbara Jane Jensen"},
+		{`title eq "  leading and trailing  "`, "  leading and trailing  "},
+		{`title eq "and or not"`, "and or not"},
+		{`title eq "quoted \"value\""`, `quoted "value"`},
+		{`loginCount eq 42`, json.Number("42")},
+		{`active eq true`, true},
+		{`manager eq null`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			expr, err := Parse(test.filter)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			e, ok := expr.(*AttributeExpression)
+			if !ok {
+				t.Fatalf("got %T, want *AttributeExpression", expr)
+			}
+			if e.Value != test.want {
+				t.Errorf("got value %#v, want %#v", e.Value, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName xx "bjensen"`,
+		`userName eq "bjensen`,
+		`(userName eq "bjensen"`,
+		`userName eq "bjensen" and`,
+	} {
+		if _, err := Parse(filter); err == nil {
+			t.Errorf("Parse(%q): got no error", filter)
+		}
+	}
+}
+
+func TestCaseExact(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`userName eq "BJensen"`, false},
+		{`userName co "JEN"`, false},
+		{`userName sw "bjen"`, true},
+		{`userName ew "SEN"`, false},
+		{`userName ne "BJensen"`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			expr, err := Parse(test.filter)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			expr.(*AttributeExpression).CaseExact = true
+			if got := expr.Matches(testUser()); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLogicalPrecedence(t *testing.T) {
+	// "and" binds tighter than "or": a or (b and c)
+	expr, err := Parse(`a eq "x" or b eq "y" and c eq "z"`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	or, ok := expr.(*LogicalExpression)
+	if !ok || or.Operator != Or {
+		t.Fatalf("got %#v, want an or expression", expr)
+	}
+	if and, ok := or.Right.(*LogicalExpression); !ok || and.Operator != And {
+		t.Errorf("got right operand %#v, want an and expression", or.Right)
+	}
+
+	tests := []struct {
+		filter     string
+		attributes map[string]interface{}
+		want       bool
+	}{
+		{`a eq "x" or b eq "y" and c eq "z"`, map[string]interface{}{"a": "x"}, true},
+		{`a eq "x" or b eq "y" and c eq "z"`, map[string]interface{}{"b": "y"}, false},
+		{`a eq "x" or b eq "y" and c eq "z"`, map[string]interface{}{"b": "y", "c": "z"}, true},
+		{`(a eq "x" or b eq "y") and c eq "z"`, map[string]interface{}{"a": "x"}, false},
+		{`(a eq "x" or b eq "y") and c eq "z"`, map[string]interface{}{"b": "y", "c": "z"}, true},
+		{`b eq "y" and c eq "z" or a eq "x"`, map[string]interface{}{"a": "x"}, true},
+		{`not (a eq "x") and b eq "y"`, map[string]interface{}{"b": "y"}, true},
+		{`not (a eq "x" or b eq "y") and c eq "z"`, map[string]interface{}{"b": "y", "c": "z"}, false},
+		{`not (not (a eq "x"))`, map[string]interface{}{"a": "x"}, true},
+		{`((a eq "x") or (b eq "y" and (c eq "z" or c eq "w"))) and not (d pr)`, map[string]interface{}{"b": "y", "c": "w"}, true},
+		{`((a eq "x") or (b eq "y" and (c eq "z" or c eq "w"))) and not (d pr)`, map[string]interface{}{"b": "y", "c": "w", "d": "v"}, false},
+		{`a eq "x" AND b eq "y" OR c eq "z"`, map[string]interface{}{"c": "z"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			expr, err := Parse(test.filter)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := expr.Matches(test.attributes); got != test.want {
+				t.Errorf("Matches(%v): got %v, want %v", test.attributes, got, test.want)
+			}
+		})
+	}
+}
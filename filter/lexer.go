@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord is an attribute path, an operator or a keyword such as true, false and null.
+	tokenWord
+	tokenString
+	tokenNumber
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
+)
+
+type token struct {
+	kind tokenKind
+	// text is the raw text of the token, for strings it is the unquoted value.
+	text string
+	// pos is the byte offset of the token in the filter.
+	pos int
+}
+
+// lex splits a filter into tokens.
+func lex(filter string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(filter) {
+		c := filter[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLeftBracket, text: "[", pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRightBracket, text: "]", pos: i})
+			i++
+		case c == '"':
+			end, err := stringEnd(filter, i)
+			if err != nil {
+				return nil, err
+			}
+			var value string
+			if err := json.Unmarshal([]byte(filter[i:end]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %v", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: i})
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(filter) && strings.IndexByte("0123456789.eE+-", filter[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: filter[i:end], pos: i})
+			i = end
+		default:
+			end := i
+			for end < len(filter) && strings.IndexByte(" \t\n\r()[]\"", filter[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: filter[i:end], pos: i})
+			i = end
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(filter)}), nil
+}
+
+// stringEnd returns the offset directly after the closing quote of the string starting at start.
+func stringEnd(filter string, start int) (int, error) {
+	for i := start + 1; i < len(filter); i++ {
+		switch filter[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string at position %d", start)
+}
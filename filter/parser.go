@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Parse parses a SCIM filter, e.g. `userName eq "bjensen" and not (active eq false)`.
+// The "and" operator binds tighter than "or".
+func Parse(filter string) (Expression, error) {
+	tokens, err := lex(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// inValuePath is set while parsing the filter between the brackets of a value path
+	inValuePath bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword reports whether the next token is the given (case-insensitive) keyword.
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// parseOr parses `FILTER *("or" FILTER)`.
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpression{Operator: Or, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses `FILTER *("and" FILTER)`.
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpression{Operator: And, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseFactor parses `"not" "(" FILTER ")"`, `"(" FILTER ")"` or an attribute expression.
+func (p *parser) parseFactor() (Expression, error) {
+	if p.isKeyword("not") && p.tokens[p.pos+1].kind == tokenLeftParen {
+		p.next()
+		expr, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpression{Expression: expr}, nil
+	}
+	if p.peek().kind == tokenLeftParen {
+		return p.parseGroup()
+	}
+	return p.parseAttributeExpression()
+}
+
+// parseGroup parses `"(" FILTER ")"`.
+func (p *parser) parseGroup() (Expression, error) {
+	if t := p.next(); t.kind != tokenLeftParen {
+		return nil, fmt.Errorf("expected ( at position %d", t.pos)
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokenRightParen {
+		return nil, fmt.Errorf("expected ) at position %d", t.pos)
+	}
+	return expr, nil
+}
+
+// parseAttributeExpression parses `attrPath "pr"`, `attrPath compareOp compValue` or `attrPath "[" valFilter "]"`.
+func (p *parser) parseAttributeExpression() (Expression, error) {
+	attr := p.next()
+	if attr.kind != tokenWord {
+		return nil, fmt.Errorf("expected attribute path at position %d", attr.pos)
+	}
+	if p.peek().kind == tokenLeftBracket {
+		return p.parseValuePath(attr)
+	}
+
+	op := p.next()
+	if op.kind != tokenWord {
+		return nil, fmt.Errorf("expected operator after %q at position %d", attr.text, op.pos)
+	}
+	operator := Operator(strings.ToLower(op.text))
+	if !operator.valid() {
+		return nil, fmt.Errorf("unsupported operator %q at position %d", op.text, op.pos)
+	}
+
+	if operator == Present {
+		return &AttributeExpression{AttributePath: attr.text, Operator: operator}, nil
+	}
+
+	t := p.peek()
+	value, err := p.parseCompareValue()
+	if err != nil {
+		return nil, err
+	}
+	// booleans and null only support equality, see RFC 7644 section 3.4.2.2
+	if _, ok := value.(bool); (ok || value == nil) && operator != Equal && operator != NotEqual {
+		return nil, fmt.Errorf("unsupported operator %q for %s at position %d", op.text, t.text, t.pos)
+	}
+	return &AttributeExpression{AttributePath: attr.text, Operator: operator, Value: value}, nil
+}
+
+// parseValuePath parses `"[" valFilter "]"` following the attribute path attr. Value filters can't be nested.
+func (p *parser) parseValuePath(attr token) (Expression, error) {
+	bracket := p.next()
+	if p.inValuePath {
+		return nil, fmt.Errorf("nested value filter at position %d", bracket.pos)
+	}
+
+	p.inValuePath = true
+	expr, err := p.parseOr()
+	p.inValuePath = false
+	if err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokenRightBracket {
+		return nil, fmt.Errorf("expected ] at position %d", t.pos)
+	}
+	return &ValuePathExpression{AttributePath: attr.text, Filter: expr}, nil
+}
+
+// parseCompareValue parses a string, number, true, false or null literal.
+func (p *parser) parseCompareValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenNumber:
+		var n json.Number
+		if err := json.Unmarshal([]byte(t.text), &n); err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return n, nil
+	case tokenWord:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	case tokenEOF:
+		return nil, fmt.Errorf("expected value at position %d", t.pos)
+	}
+	return nil, fmt.Errorf("invalid value %q at position %d", t.text, t.pos)
+}
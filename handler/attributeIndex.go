@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// Verify attributeIndex is of type FilterStore, WalkStore and CountStore
+var _ FilterStore = &attributeIndex{}
+var _ WalkStore = &attributeIndex{}
+var _ CountStore = &attributeIndex{}
+
+// attributeIndex keeps indexes from the values of top-level string attributes, such as userName, to the records
+// having them, so an equality filter such as `userName eq "bjensen"` doesn't have to scan every record. Like
+// membershipIndex it is built on creation and kept up to date on writes through it, it assumes no other process writes
+// to the store.
+type attributeIndex struct {
+	Store
+	// mu serializes writes so the indexes reflect the order in which they were applied to the store
+	mu      sync.RWMutex
+	indexes map[string]*valueIndex
+}
+
+// valueIndex indexes the values of one attribute.
+type valueIndex struct {
+	// ids maps a lower-cased value to the ids of the records having it
+	ids map[string]map[string]struct{}
+	// keys maps the id of a record to its indexed value
+	keys map[string]string
+	// unindexed holds the ids of the records with a value that isn't a string, e.g. a boolean, which an equality
+	// filter may still match after coercion
+	unindexed map[string]struct{}
+}
+
+// NewAttributeIndex returns a FilterStore serving equality filters on the given attributes of the records in s from
+// indexes, other filters are left to s.
+func NewAttributeIndex(s Store, attributes ...string) (FilterStore, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &attributeIndex{
+		Store:   s,
+		indexes: make(map[string]*valueIndex, len(attributes)),
+	}
+	for _, attribute := range attributes {
+		i.indexes[strings.ToLower(attribute)] = &valueIndex{
+			ids:       make(map[string]map[string]struct{}),
+			keys:      make(map[string]string),
+			unindexed: make(map[string]struct{}),
+		}
+	}
+	for _, record := range records {
+		i.index(record)
+	}
+	return i, nil
+}
+
+func (i *attributeIndex) Put(record Record) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.Put(record); err != nil {
+		return err
+	}
+	i.index(record)
+	return nil
+}
+
+func (i *attributeIndex) Delete(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.Delete(id); err != nil {
+		return err
+	}
+	i.unindex(id)
+	return nil
+}
+
+func (i *attributeIndex) DeleteAll() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.DeleteAll(); err != nil {
+		return err
+	}
+	for _, idx := range i.indexes {
+		idx.ids = make(map[string]map[string]struct{})
+		idx.keys = make(map[string]string)
+		idx.unindexed = make(map[string]struct{})
+	}
+	return nil
+}
+
+func (i *attributeIndex) Patch(id string, fn func(record *Record) error) (Record, error) {
+	return i.PatchWithVersion(id, "", fn)
+}
+
+func (i *attributeIndex) PatchWithVersion(id, expectedVersion string, fn func(record *Record) error) (Record, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	record, err := i.Store.PatchWithVersion(id, expectedVersion, fn)
+	if err != nil {
+		return Record{}, err
+	}
+	i.index(record)
+	return record, nil
+}
+
+// ListMatching returns the records that may match the equality comparisons on indexed attributes expr requires, e.g.
+// `userName eq "bjensen"` or `externalId eq "a" or externalId eq "b"`, otherwise it falls back to the store.
+func (i *attributeIndex) ListMatching(expr filter.Expression) ([]Record, error) {
+	i.mu.RLock()
+	ids, ok := i.candidates(expr)
+	i.mu.RUnlock()
+	if !ok {
+		return listMatching(i.Store, expr)
+	}
+
+	records := make([]Record, 0, len(ids))
+	for id := range ids {
+		record, err := i.Store.Get(id)
+		if err == ErrNotFound {
+			// deleted since the index was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Walk lets the store pass its records one at a time if it can.
+func (i *attributeIndex) Walk(fn func(record Record) error) error {
+	return walk(i.Store, fn)
+}
+
+// Count lets the store count its records if it can.
+func (i *attributeIndex) Count() (int, error) {
+	return Count(i.Store)
+}
+
+// candidates returns the ids of a superset of the records matching expr, ok is false if the indexes can't narrow them
+// down, e.g. for a "not" or an "or" with a side that isn't indexed. The caller holds mu.
+func (i *attributeIndex) candidates(expr filter.Expression) (map[string]struct{}, bool) {
+	switch e := expr.(type) {
+	case *filter.LogicalExpression:
+		left, leftOk := i.candidates(e.Left)
+		right, rightOk := i.candidates(e.Right)
+		if e.Operator == filter.And {
+			switch {
+			case leftOk && rightOk:
+				return intersect(left, right), true
+			case leftOk:
+				return left, true
+			}
+			return right, rightOk
+		}
+		if !leftOk || !rightOk {
+			return nil, false
+		}
+		for id := range right {
+			left[id] = struct{}{}
+		}
+		return left, true
+	case *filter.AttributeExpression:
+		idx, ok := i.indexes[strings.ToLower(e.AttributePath)]
+		if !ok || e.Operator != filter.Equal {
+			return nil, false
+		}
+		value, ok := e.Value.(string)
+		if !ok {
+			// a number or boolean may equal a value stored as a string
+			return nil, false
+		}
+		if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			// timestamps are compared as times, equal times may be formatted differently
+			return nil, false
+		}
+
+		ids := make(map[string]struct{}, len(idx.ids[strings.ToLower(value)])+len(idx.unindexed))
+		for id := range idx.ids[strings.ToLower(value)] {
+			ids[id] = struct{}{}
+		}
+		for id := range idx.unindexed {
+			ids[id] = struct{}{}
+		}
+		return ids, true
+	}
+	return nil, false
+}
+
+// intersect returns the ids in both a and b.
+func intersect(a, b map[string]struct{}) map[string]struct{} {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	ids := make(map[string]struct{}, len(a))
+	for id := range a {
+		if _, ok := b[id]; ok {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// index replaces the indexed values of the record with those of record. The caller holds mu.
+func (i *attributeIndex) index(record Record) {
+	i.unindex(record.ID)
+
+	for attribute, idx := range i.indexes {
+		k, ok := attributeKey(record.Attributes, attribute)
+		if !ok {
+			continue
+		}
+		value, ok := record.Attributes[k].(string)
+		if !ok {
+			idx.unindexed[record.ID] = struct{}{}
+			continue
+		}
+
+		key := strings.ToLower(value)
+		if idx.ids[key] == nil {
+			idx.ids[key] = make(map[string]struct{})
+		}
+		idx.ids[key][record.ID] = struct{}{}
+		idx.keys[record.ID] = key
+	}
+}
+
+// unindex removes the record with the given id from the indexes. The caller holds mu.
+func (i *attributeIndex) unindex(id string) {
+	for _, idx := range i.indexes {
+		delete(idx.unindexed, id)
+		key, ok := idx.keys[id]
+		if !ok {
+			continue
+		}
+		delete(idx.ids[key], id)
+		if len(idx.ids[key]) == 0 {
+			delete(idx.ids, key)
+		}
+		delete(idx.keys, id)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/elimity-com/scim"
+)
+
+// newIndexedUserHandler returns a handler of users kept in memory with userName and externalId indexed.
+func newIndexedUserHandler(t *testing.T) SchemaResourceHandler {
+	t.Helper()
+
+	store, err := NewAttributeIndex(NewMemoryStore(), "userName", "externalId")
+	if err != nil {
+		t.Fatalf("NewAttributeIndex: %v", err)
+	}
+	return NewSchemaResourceHandler(testLogger(), "User", store, testUserSchema(), 100)
+}
+
+func TestAttributeIndexMatchesScan(t *testing.T) {
+	indexed := newTestServer(t, newIndexedUserHandler(t), newTestGroupHandler())
+	scanned := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	for _, server := range []http.Handler{indexed, scanned} {
+		mustCreate(t, server, "/Users", `{"userName": "bjensen", "externalId": "a1", "nickName": "Babs"}`)
+		mustCreate(t, server, "/Users", `{"userName": "BJensen2", "externalId": "A1"}`)
+		jsmith := mustCreate(t, server, "/Users", `{"userName": "jsmith", "externalId": "b2", "nickName": "Babs"}`)
+		mmoe := mustCreate(t, server, "/Users", `{"userName": "mmoe"}`)
+		// writes keep the index up to date
+		serve(server, http.MethodPatch, "/Users/"+jsmith, patchBody(`[{"op": "replace", "path": "userName", "value": "jsmith2"}]`))
+		serve(server, http.MethodDelete, "/Users/"+mmoe, "")
+	}
+
+	for _, filter := range []string{
+		`userName eq "bjensen"`,
+		`userName eq "BJENSEN"`,
+		`userName eq "jsmith"`,
+		`userName eq "jsmith2"`,
+		`userName eq "mmoe"`,
+		`externalId eq "a1"`,
+		`externalId eq "a1" and nickName eq "Babs"`,
+		`userName eq "bjensen" or externalId eq "b2"`,
+		`userName eq "bjensen" or nickName eq "Babs"`,
+		`not (userName eq "bjensen")`,
+		`userName sw "bj"`,
+	} {
+		want := listUserNames(t, scanned, filter)
+		if got := listUserNames(t, indexed, filter); !reflect.DeepEqual(got, want) {
+			t.Errorf("filter %s: got %v from the index, want %v from a scan", filter, got, want)
+		}
+	}
+}
+
+func BenchmarkAttributeIndex(b *testing.B) {
+	const n = 10000
+	// the records are put in the store directly, creating them through the handler checks uniqueness by a scan
+	seeded := NewMemoryStore()
+	for i := 0; i < n; i++ {
+		if err := seeded.Put(Record{ID: fmt.Sprint(i), Attributes: scim.ResourceAttributes{"userName": fmt.Sprintf("user%d", i)}}); err != nil {
+			b.Fatalf("Put: %v", err)
+		}
+	}
+	indexed, err := NewAttributeIndex(seeded, "userName")
+	if err != nil {
+		b.Fatalf("NewAttributeIndex: %v", err)
+	}
+	target := "/Users?filter=" + url.QueryEscape(fmt.Sprintf(`userName eq "user%d"`, n/2))
+
+	for name, store := range map[string]Store{"indexed": indexed, "scan": seeded} {
+		users := NewSchemaResourceHandler(testLogger(), "User", store, testUserSchema(), 100)
+		server := newTestServer(b, users, newTestGroupHandler())
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if w := serve(server, http.MethodGet, target, ""); w.Code != http.StatusOK {
+					b.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+				}
+			}
+		})
+	}
+}
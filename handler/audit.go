@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuditOperation is the kind of change an AuditEntry records.
+type AuditOperation string
+
+const (
+	AuditCreate  AuditOperation = "create"
+	AuditReplace AuditOperation = "replace"
+	AuditPatch   AuditOperation = "patch"
+	AuditDelete  AuditOperation = "delete"
+)
+
+// AuditEntry records a change to a resource.
+type AuditEntry struct {
+	Time         time.Time      `json:"time"`
+	Operation    AuditOperation `json:"operation"`
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id"`
+	// Actor is the principal of the request, empty if it is not authenticated as a user.
+	Actor string `json:"actor,omitempty"`
+	// BeforeVersion is the version of the resource before the change, empty for create.
+	BeforeVersion string `json:"beforeVersion,omitempty"`
+	// AfterVersion is the version of the resource after the change, empty for delete.
+	AfterVersion string `json:"afterVersion,omitempty"`
+}
+
+// AuditLog is an append-only log of the changes to resources.
+type AuditLog interface {
+	// Append adds entry to the end of the log.
+	Append(entry AuditEntry) error
+	// Entries returns all entries in the order they were appended.
+	Entries() ([]AuditEntry, error)
+}
+
+// Verify memoryAuditLog is of type AuditLog
+var _ AuditLog = &memoryAuditLog{}
+
+// memoryAuditLog keeps the entries in memory, they are lost on restart.
+type memoryAuditLog struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+func NewMemoryAuditLog() AuditLog {
+	return &memoryAuditLog{}
+}
+
+func (l *memoryAuditLog) Append(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *memoryAuditLog) Entries() ([]AuditEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := make([]AuditEntry, len(l.entries))
+	copy(entries, l.entries)
+	return entries, nil
+}
+
+// audit appends entry to the audit log of the handler, if any, with the time and the actor of r. The change is already
+// stored, so failing to append is only logged.
+func (o options) audit(log *logrus.Entry, r *http.Request, entry AuditEntry) {
+	if o.auditLog == nil {
+		return
+	}
+	entry.Time = o.now()
+	entry.Actor = Principal(r.Context())
+	if err := o.auditLog.Append(entry); err != nil {
+		log.Errorf("Failed to append %s of %s %s to the audit log: %v", entry.Operation, entry.ResourceType, entry.ID, err)
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elimity-com/scim"
+)
+
+func TestAuditLog(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	auditLog := NewMemoryAuditLog()
+	h := newTestUserHandler(WithClock(clock), WithAuditLog(auditLog))
+	r := testRequest()
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := h.Patch(r, created.ID, []scim.PatchOperation{
+		{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": "Babs"}},
+	}); err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	// a patch that changes nothing is not a change
+	if _, err := h.Patch(r, created.ID, []scim.PatchOperation{
+		{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": "Babs"}},
+	}); err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	entries, err := auditLog.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	want := []AuditEntry{
+		{Time: start, Operation: AuditCreate, ResourceType: "User", ID: created.ID, AfterVersion: "1"},
+		{Time: start.Add(time.Minute), Operation: AuditPatch, ResourceType: "User", ID: created.ID, BeforeVersion: "1", AfterVersion: "2"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got entries %+v, want %+v", entries, want)
+	}
+}
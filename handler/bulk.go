@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/elimity-com/scim/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bulkResponseSchema = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	// bulkIDPrefix marks a reference to the resource created by the operation with that bulkId, e.g. `bulkId:qwerty`.
+	bulkIDPrefix = "bulkId:"
+	// maxBulkOperations and maxBulkPayloadSize are the limits advertised in the service provider config.
+	maxBulkOperations  = 1000
+	maxBulkPayloadSize = 1 << 20
+)
+
+type bulkRequest struct {
+	Schemas      []string        `json:"schemas"`
+	FailOnErrors int             `json:"failOnErrors"`
+	Operations   []bulkOperation `json:"Operations"`
+}
+
+type bulkOperation struct {
+	Method  string      `json:"method"`
+	BulkID  string      `json:"bulkId"`
+	Version string      `json:"version"`
+	Path    string      `json:"path"`
+	Data    interface{} `json:"data"`
+}
+
+type bulkResponse struct {
+	Schemas    []string                `json:"schemas"`
+	Operations []bulkOperationResponse `json:"Operations"`
+}
+
+type bulkOperationResponse struct {
+	Method   string          `json:"method"`
+	BulkID   string          `json:"bulkId,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	Location string          `json:"location,omitempty"`
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// BulkHandler serves the /Bulk endpoint by dispatching each operation of a bulk request to the SCIM server.
+type BulkHandler struct {
+	// server serves the individual operations, paths are relative to it, e.g. `/Users`
+	server http.Handler
+	logger *logrus.Logger
+	// concurrency is the maximum number of operations of a request dispatched at the same time
+	concurrency int
+}
+
+func NewBulkHandler(l *logrus.Logger, server http.Handler, concurrency int) BulkHandler {
+	return BulkHandler{
+		server:      server,
+		logger:      l,
+		concurrency: concurrency,
+	}
+}
+
+func (h BulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := RequestLogger(h.logger, r)
+
+	var req bulkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBulkPayloadSize)).Decode(&req); err != nil {
+		logger.Errorf("Failed to decode bulk request: %v", err)
+		if maxBytesErr, ok := err.(*http.MaxBytesError); ok {
+			WriteError(w, errors.ScimError{
+				Detail: fmt.Sprintf("The bulk request exceeds the maximum payload size of %d bytes.", maxBytesErr.Limit),
+				Status: http.StatusRequestEntityTooLarge,
+			})
+			return
+		}
+		WriteError(w, errors.ScimErrorInvalidSyntax)
+		return
+	}
+	if len(req.Operations) > maxBulkOperations {
+		WriteError(w, errors.ScimError{
+			Detail: fmt.Sprintf("The bulk request has %d operations, the maximum is %d.", len(req.Operations), maxBulkOperations),
+			Status: http.StatusRequestEntityTooLarge,
+		})
+		return
+	}
+	logger.Infof("Processing bulk request with %d operations", len(req.Operations))
+
+	// locations are reported relative to the endpoint the bulk request was sent to, e.g. `/scim/v2`
+	base := fmt.Sprintf("%s://%s%s", scheme(r), r.Host, strings.TrimSuffix(r.URL.Path, "/Bulk"))
+
+	resp := bulkResponse{
+		Schemas:    []string{bulkResponseSchema},
+		Operations: make([]bulkOperationResponse, 0, len(req.Operations)),
+	}
+	for _, result := range h.doAll(r, req, base) {
+		if result != nil {
+			resp.Operations = append(resp.Operations, *result)
+		}
+	}
+
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		logger.Errorf("Failed to marshal bulk response: %v", err)
+		WriteError(w, errors.ScimErrorInternal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(raw)
+}
+
+// doAll performs the operations of req, up to h.concurrency at the same time, and returns their results in the order
+// of the operations. An operation waits for the earlier operations it depends on, see bulkDependencies. Once
+// failOnErrors operations failed no further operations are started, their results are nil.
+func (h BulkHandler) doAll(r *http.Request, req bulkRequest, base string) []*bulkOperationResponse {
+	logger := RequestLogger(h.logger, r)
+	results := make([]*bulkOperationResponse, len(req.Operations))
+	done := make([]chan struct{}, len(req.Operations))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(h.concurrency, 1))
+		// mu guards bulkIDs and failed
+		mu sync.Mutex
+		// bulkIDs maps the bulkId of each created resource to its id
+		bulkIDs = make(map[string]string)
+		failed  = 0
+	)
+	for i, op := range req.Operations {
+		deps := bulkDependencies(req.Operations, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			for _, d := range deps {
+				<-done[d]
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			mu.Lock()
+			// failOnErrors is optional, when unset all operations are processed
+			if req.FailOnErrors > 0 && failed >= req.FailOnErrors {
+				mu.Unlock()
+				return
+			}
+			// the operations creating the referenced resources are done
+			resolved := make(map[string]string, len(bulkIDs))
+			for k, v := range bulkIDs {
+				resolved[k] = v
+			}
+			mu.Unlock()
+
+			result, id := h.do(r, op, resolved, base)
+			results[i] = &result
+
+			mu.Lock()
+			defer mu.Unlock()
+			if id != "" {
+				bulkIDs[op.BulkID] = id
+			}
+			if result.Response != nil {
+				failed++
+				if req.FailOnErrors > 0 && failed == req.FailOnErrors {
+					logger.Warnf("Stopping bulk request after %d failed operations", failed)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// bulkDependencies returns the indexes of the operations before the i-th one that must be done before it: those
+// creating a resource it references by bulkId and the last one with the same path, e.g. a PATCH of a user that is
+// deleted next. POST operations to the same endpoint are independent.
+func bulkDependencies(ops []bulkOperation, i int) []int {
+	refs := make(map[string]bool)
+	collectBulkIDRefs(ops[i].Path, refs)
+	collectBulkIDRefs(ops[i].Data, refs)
+
+	var deps []int
+	samePath := strings.ToUpper(ops[i].Method) != http.MethodPost
+	for j := i - 1; j >= 0; j-- {
+		switch {
+		case strings.ToUpper(ops[j].Method) == http.MethodPost && refs[ops[j].BulkID]:
+			deps = append(deps, j)
+			delete(refs, ops[j].BulkID)
+		case samePath && ops[j].Path == ops[i].Path:
+			deps = append(deps, j)
+			samePath = false
+		}
+	}
+	return deps
+}
+
+// collectBulkIDRefs adds the bulkIds referenced in v, a path or decoded JSON value, to refs.
+func collectBulkIDRefs(v interface{}, refs map[string]bool) {
+	switch v := v.(type) {
+	case string:
+		for _, segment := range strings.Split(v, "/") {
+			if ref, ok := strings.CutPrefix(segment, bulkIDPrefix); ok {
+				refs[ref] = true
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			collectBulkIDRefs(e, refs)
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectBulkIDRefs(e, refs)
+		}
+	}
+}
+
+// do performs a single bulk operation against the server, resolving references to the resources created earlier with
+// bulkIDs. Returns the id of the resource created by a POST.
+func (h BulkHandler) do(r *http.Request, op bulkOperation, bulkIDs map[string]string, base string) (bulkOperationResponse, string) {
+	method := strings.ToUpper(op.Method)
+	result := bulkOperationResponse{
+		Method:  method,
+		BulkID:  op.BulkID,
+		Version: op.Version,
+	}
+	fail := func(scimErr errors.ScimError) (bulkOperationResponse, string) {
+		result.Status = fmt.Sprint(scimErr.Status)
+		result.Response, _ = json.Marshal(scimErr)
+		return result, ""
+	}
+
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fail(errors.ScimErrorBadRequest(fmt.Sprintf("Unsupported bulk operation method %q.", op.Method)))
+	}
+	if method == http.MethodPost && op.BulkID == "" {
+		return fail(errors.ScimErrorBadRequest("The bulkId is required for POST operations."))
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		return fail(errors.ScimErrorInvalidPath)
+	}
+
+	path, err := resolveBulkIDs(op.Path, bulkIDs)
+	if err != nil {
+		return fail(unresolvedBulkID(err))
+	}
+	data, err := resolveBulkIDs(op.Data, bulkIDs)
+	if err != nil {
+		return fail(unresolvedBulkID(err))
+	}
+
+	var body []byte
+	if data != nil {
+		body, err = json.Marshal(data)
+		if err != nil {
+			return fail(errors.ScimErrorInvalidSyntax)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), method, path.(string), bytes.NewReader(body))
+	if err != nil {
+		return fail(errors.ScimErrorInvalidPath)
+	}
+	req.Header.Set("Content-Type", "application/scim+json")
+	if op.Version != "" {
+		req.Header.Set("If-Match", op.Version)
+	}
+
+	RequestLogger(h.logger, r).Infof("Bulk operation: %s %s", method, path)
+	rec := newResponseBuffer()
+	h.server.ServeHTTP(rec, req)
+
+	result.Status = fmt.Sprint(rec.status)
+	if rec.status >= http.StatusBadRequest {
+		result.Response = rec.body.Bytes()
+		return result, ""
+	}
+	if etag := rec.Header().Get("Etag"); etag != "" {
+		result.Version = etag
+	}
+
+	var resource struct {
+		ID   string `json:"id"`
+		Meta struct {
+			Location string `json:"location"`
+		} `json:"meta"`
+	}
+	_ = json.Unmarshal(rec.body.Bytes(), &resource)
+
+	var created string
+	switch method {
+	case http.MethodPost:
+		if resource.ID != "" {
+			created = resource.ID
+			result.Location = base + path.(string) + "/" + resource.ID
+		}
+	default:
+		result.Location = base + path.(string)
+	}
+	// prefer the location of the server, it is absolute if configured with an external base URL
+	if strings.Contains(resource.Meta.Location, "://") {
+		result.Location = resource.Meta.Location
+	}
+	return result, created
+}
+
+// resolveBulkIDs returns a copy of v, a path or decoded JSON value, with all `bulkId:` references replaced by the id of
+// the referenced resource. Returns an error if a reference can't be resolved.
+func resolveBulkIDs(v interface{}, bulkIDs map[string]string) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, bulkIDPrefix) {
+			return v, nil
+		}
+		// a path references a bulkId as one of its segments, e.g. `/Groups/bulkId:qwerty`
+		segments := strings.Split(v, "/")
+		for i, segment := range segments {
+			ref, ok := strings.CutPrefix(segment, bulkIDPrefix)
+			if !ok {
+				continue
+			}
+			id, ok := bulkIDs[ref]
+			if !ok {
+				return nil, fmt.Errorf("bulkId %q does not reference a resource created earlier in this request", ref)
+			}
+			segments[i] = id
+		}
+		return strings.Join(segments, "/"), nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			resolved, err := resolveBulkIDs(e, bulkIDs)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, e := range v {
+			resolved, err := resolveBulkIDs(e, bulkIDs)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = resolved
+		}
+		return arr, nil
+	default:
+		return v, nil
+	}
+}
+
+// unresolvedBulkID returns the 409 SCIM error of an operation referencing a bulkId that can't be resolved.
+func unresolvedBulkID(err error) errors.ScimError {
+	return errors.ScimError{
+		ScimType: errors.ScimTypeInvalidValue,
+		Detail:   fmt.Sprintf("Failed to resolve bulkId reference: %v.", err),
+		Status:   http.StatusConflict,
+	}
+}
+
+// scheme returns the URL scheme the request was received with.
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
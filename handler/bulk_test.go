@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bulkOperations posts the bulk request body to h and returns the operations of the response.
+func bulkOperations(t *testing.T, h http.Handler, body string) []interface{} {
+	t.Helper()
+
+	w := serve(h, http.MethodPost, "/Bulk", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	operations, _ := decodeBody(t, w)["Operations"].([]interface{})
+	return operations
+}
+
+func TestBulkMixedBatch(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	mustCreate(t, server, "/Users", `{"userName": "jsmith"}`)
+	bulk := NewBulkHandler(testLogger(), server, 4)
+
+	operations := bulkOperations(t, bulk, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [
+			{"method": "POST", "path": "/Users", "bulkId": "bjensen", "data": {"userName": "bjensen"}},
+			{"method": "POST", "path": "/Users", "bulkId": "duplicate", "data": {"userName": "jsmith"}},
+			{"method": "POST", "path": "/Groups", "bulkId": "guides", "data": {"displayName": "Tour Guides", "members": [{"value": "bulkId:bjensen"}]}},
+			{"method": "PATCH", "path": "/Users/bulkId:bjensen", "data": {
+				"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+				"Operations": [{"op": "replace", "path": "nickName", "value": "Babs"}]
+			}},
+			{"method": "DELETE", "path": "/Users/missing"}
+		]
+	}`)
+
+	want := []string{"201", "409", "201", "200", "404"}
+	if len(operations) != len(want) {
+		t.Fatalf("got %d operation results, want %d: %v", len(operations), len(want), operations)
+	}
+	for i, status := range want {
+		op := operations[i].(map[string]interface{})
+		if op["status"] != status {
+			t.Errorf("operation %d: got status %v, want %s: %v", i, op["status"], status, op["response"])
+		}
+		if failed := status >= "400"; failed != (op["response"] != nil) {
+			t.Errorf("operation %d: got response %v", i, op["response"])
+		}
+	}
+
+	groups := decodeBody(t, serve(server, http.MethodGet, "/Groups", ""))["Resources"].([]interface{})
+	members, _ := groups[0].(map[string]interface{})["members"].([]interface{})
+	if len(members) != 1 {
+		t.Fatalf("got members %v, want bjensen", members)
+	}
+	value, _ := members[0].(map[string]interface{})["value"].(string)
+	if user := decodeBody(t, serve(server, http.MethodGet, "/Users/"+value, "")); user["userName"] != "bjensen" {
+		t.Errorf("got member %q, want the id of bjensen", value)
+	}
+}
+
+func TestBulkLargeBatch(t *testing.T) {
+	const (
+		n           = 200
+		concurrency = 4
+	)
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	// count the operations the bulk handler performs at the same time
+	var inFlight, maxInFlight atomic.Int32
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		server.ServeHTTP(w, r)
+	})
+	bulk := NewBulkHandler(testLogger(), counting, concurrency)
+
+	ops := make([]string, n)
+	for i := range ops {
+		ops[i] = fmt.Sprintf(`{"method": "POST", "path": "/Users", "bulkId": "u%d", "data": {"userName": "user%03d"}}`, i, i)
+	}
+	operations := bulkOperations(t, bulk, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:BulkRequest"],
+		"Operations": [`+strings.Join(ops, ",")+`]
+	}`)
+
+	if len(operations) != n {
+		t.Fatalf("got %d operation results, want %d", len(operations), n)
+	}
+	locations := make(map[string]bool, n)
+	for i, operation := range operations {
+		op := operation.(map[string]interface{})
+		if op["status"] != "201" || op["bulkId"] != fmt.Sprintf("u%d", i) {
+			t.Errorf("operation %d: got status %v and bulkId %v, want 201 and u%d", i, op["status"], op["bulkId"], i)
+		}
+		location, _ := op["location"].(string)
+		locations[location] = true
+	}
+	if len(locations) != n {
+		t.Errorf("got %d distinct locations, want %d", len(locations), n)
+	}
+	if got := decodeBody(t, serve(server, http.MethodGet, "/Users?count=1", ""))["totalResults"]; got != json.Number(fmt.Sprint(n)) {
+		t.Errorf("got %v users, want %d", got, n)
+	}
+	if got := maxInFlight.Load(); got > concurrency {
+		t.Errorf("got %d operations at the same time, want at most %d", got, concurrency)
+	}
+}
@@ -0,0 +1,20 @@
+package handler
+
+import "time"
+
+// Clock tells the time resources are created and modified at.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock returns the Clock of the system time.
+func SystemClock() Clock {
+	return realClock{}
+}
+
+// realClock is the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
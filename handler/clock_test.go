@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elimity-com/scim"
+)
+
+// Verify fakeClock is of type Clock
+var _ Clock = &fakeClock{}
+
+// fakeClock is a Clock that only moves when told to, so tests can assert exact meta timestamps.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newFakeClock returns a fakeClock set to now.
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestClockTimestamps(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	h := newTestUserHandler(WithClock(clock))
+	r := testRequest()
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !created.Meta.Created.Equal(start) || !created.Meta.LastModified.Equal(start) {
+		t.Errorf("Create: got created %v and lastModified %v, want %v", created.Meta.Created, created.Meta.LastModified, start)
+	}
+
+	clock.Advance(90 * time.Minute)
+	patched, err := h.Patch(r, created.ID, []scim.PatchOperation{
+		{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"active": false}},
+	})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if want := start.Add(90 * time.Minute); !patched.Meta.LastModified.Equal(want) {
+		t.Errorf("Patch: got lastModified %v, want %v", patched.Meta.LastModified, want)
+	}
+	if !patched.Meta.Created.Equal(start) {
+		t.Errorf("Patch: got created %v, want %v", patched.Meta.Created, start)
+	}
+
+	got, err := h.Get(r, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !got.Meta.Created.Equal(*patched.Meta.Created) || !got.Meta.LastModified.Equal(*patched.Meta.LastModified) {
+		t.Errorf("Get: got created %v and lastModified %v, want %v and %v", got.Meta.Created, got.Meta.LastModified, patched.Meta.Created, patched.Meta.LastModified)
+	}
+}
+
+func TestClockSoftDelete(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	tombstones := NewMemoryStore()
+	s := NewSoftDeleteStore(NewMemoryStore(), tombstones, clock)
+	if err := s.Put(Record{ID: "1", Attributes: scim.ResourceAttributes{}, Meta: map[string]string{"version": "1"}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if err := s.Delete("1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	tombstone, err := tombstones.Get("1")
+	if err != nil {
+		t.Fatalf("Get tombstone: %v", err)
+	}
+	if want := start.Add(time.Hour).Format(time.RFC3339); tombstone.Meta["lastModified"] != want {
+		t.Errorf("got tombstone lastModified %q, want %q", tombstone.Meta["lastModified"], want)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// discoveryResourceTypes maps the discovery endpoints to the resource type of the resources they serve.
+var discoveryResourceTypes = map[string]string{
+	"Schemas":       "Schema",
+	"ResourceTypes": "ResourceType",
+}
+
+// DiscoveryMeta adds the meta attribute, which the library omits, to the schemas and resource types served by next,
+// see RFC 7643, section 6 and 7. The location is relative to the SCIM endpoint like the one of other resources.
+func DiscoveryMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		resourceType, ok := discoveryResourceTypes[endpoint]
+		if r.Method != http.MethodGet || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, r)
+
+		body := rec.body.Bytes()
+		if rec.status == http.StatusOK {
+			if b, err := withDiscoveryMeta(body, endpoint, resourceType); err == nil {
+				body = b
+			}
+		}
+		rec.writeTo(w, body)
+	})
+}
+
+// withDiscoveryMeta adds the meta attribute to the resource or the resources of the list response in body.
+func withDiscoveryMeta(body []byte, endpoint, resourceType string) ([]byte, error) {
+	var response map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&response); err != nil {
+		return nil, err
+	}
+
+	resources, ok := response["Resources"].([]interface{})
+	if !ok {
+		resources = []interface{}{response}
+	}
+	for _, resource := range resources {
+		resource, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := resource["id"].(string)
+		if _, ok := resource["meta"]; ok || id == "" {
+			continue
+		}
+		resource["meta"] = map[string]interface{}{
+			"resourceType": resourceType,
+			"location":     endpoint + "/" + url.PathEscape(id),
+		}
+	}
+	return json.Marshal(response)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/elimity-com/scim/errors"
+)
+
+// WriteError writes err as a SCIM error response.
+func WriteError(w http.ResponseWriter, err errors.ScimError) {
+	raw, _ := json.Marshal(err)
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(err.Status)
+	_, _ = w.Write(raw)
+}
+
+// invalidFilter returns the 400 SCIM error of a filter that could not be parsed, detailing the parse error.
+func invalidFilter(filter string, err error) errors.ScimError {
+	return errors.ScimError{
+		ScimType: errors.ScimTypeInvalidFilter,
+		Detail:   fmt.Sprintf("The filter %q is invalid: %v.", filter, err),
+		Status:   http.StatusBadRequest,
+	}
+}
+
+// MaxFilterLength rejects list requests whose filter is longer than maxLength bytes with an invalidFilter error before
+// next parses it, long filters are expensive to parse and evaluate.
+func MaxFilterLength(maxLength int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f := r.URL.Query().Get("filter"); len(f) > maxLength {
+			WriteError(w, errors.ScimError{
+				ScimType: errors.ScimTypeInvalidFilter,
+				Detail:   fmt.Sprintf("The filter is %d bytes long, the maximum is %d.", len(f), maxLength),
+				Status:   http.StatusBadRequest,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elimity-com/scim/errors"
+)
+
+// preconditionFailed returns the 412 SCIM error of a request whose If-Match header doesn't match the resource version.
+func preconditionFailed(r *http.Request) errors.ScimError {
+	return errors.ScimError{
+		Detail: fmt.Sprintf("The resource version does not match If-Match %s, it was modified.", r.Header.Get("If-Match")),
+		Status: http.StatusPreconditionFailed,
+	}
+}
+
+// nextVersion increments the version counter of a resource, a new resource starts at version 1.
+func nextVersion(version string) string {
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		// unset or written before versions were counters
+		n = 0
+	}
+	return strconv.Itoa(n + 1)
+}
+
+// ConditionalGet responds with 304 Not Modified to a GET whose If-None-Match header matches the ETag of the response
+// of next, i.e. the client already has the current version of the resource.
+func ConditionalGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if r.Method != http.MethodGet || ifNoneMatch == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, r)
+
+		if version := rec.Header().Get("Etag"); rec.status == http.StatusOK && version != "" && etagMatches(ifNoneMatch, version) {
+			rec.copyHeader(w)
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rec.writeTo(w, rec.body.Bytes())
+	})
+}
+
+// etagMatches reports whether the comma separated list of entity tags matches version, `*` matches any version. Tags
+// are compared weakly, i.e. `W/"1"`, `"1"` and a bare `1` all match version 1, as proxies may weaken strong tags.
+func etagMatches(etags, version string) bool {
+	version = opaqueTag(version)
+	for _, etag := range strings.Split(etags, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" || opaqueTag(etag) == version {
+			return true
+		}
+	}
+	return false
+}
+
+// formatETag returns version as a strong entity tag, e.g. `"1"`, or as a weak one, e.g. `W/"1"`.
+func formatETag(version string, weak bool) string {
+	if weak {
+		return `W/"` + version + `"`
+	}
+	return `"` + version + `"`
+}
+
+// opaqueTag returns the version of an entity tag, i.e. without the weak prefix and quotes.
+func opaqueTag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
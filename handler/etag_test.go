@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	etag := serve(server, http.MethodGet, "/Users/"+id, "").Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("got no ETag")
+	}
+
+	tests := []struct {
+		name, method, body, ifMatch string
+		want                        int
+	}{
+		{"stale replace", http.MethodPut, `{"userName": "bjensen", "nickName": "Babs"}`, `"0"`, http.StatusPreconditionFailed},
+		{"stale patch", http.MethodPatch, patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`), `"0"`, http.StatusPreconditionFailed},
+		{"matching replace", http.MethodPut, `{"userName": "bjensen", "nickName": "Babs"}`, etag, http.StatusOK},
+		// the replace made etag stale
+		{"patch with the replaced version", http.MethodPatch, patchBody(`[{"op": "replace", "path": "nickName", "value": "Barbara"}]`), etag, http.StatusPreconditionFailed},
+		{"patch with any version", http.MethodPatch, patchBody(`[{"op": "replace", "path": "nickName", "value": "Barbara"}]`), "*", http.StatusOK},
+	}
+	for _, test := range tests {
+		w := serve(server, test.method, "/Users/"+id, test.body, "If-Match", test.ifMatch)
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, w.Code, test.want, w.Body.String())
+		}
+	}
+
+	current := serve(server, http.MethodGet, "/Users/"+id, "").Header().Get("Etag")
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "B"}]`), "If-Match", current)
+	if w.Code != http.StatusOK {
+		t.Errorf("matching patch: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if w.Header().Get("Etag") == current {
+		t.Errorf("got ETag %s after a patch, want a new one", current)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	h := ConditionalGet(server)
+	id := mustCreate(t, h, "/Users", `{"userName": "bjensen"}`)
+
+	w := serve(h, http.MethodGet, "/Users/"+id, "")
+	etag := w.Header().Get("Etag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d and ETag %q, want 200 with an ETag", w.Code, etag)
+	}
+
+	for _, ifNoneMatch := range []string{etag, `"0", ` + etag, "*"} {
+		w := serve(h, http.MethodGet, "/Users/"+id, "", "If-None-Match", ifNoneMatch)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: got status %d, want %d", ifNoneMatch, w.Code, http.StatusNotModified)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got body %q, want none", ifNoneMatch, w.Body.String())
+		}
+		if got := w.Header().Get("Etag"); got != etag {
+			t.Errorf("If-None-Match %s: got ETag %q, want %q", ifNoneMatch, got, etag)
+		}
+	}
+
+	if w := serve(h, http.MethodGet, "/Users/"+id, "", "If-None-Match", `"0"`); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	serve(h, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`))
+	w = serve(h, http.MethodGet, "/Users/"+id, "", "If-None-Match", etag)
+	if w.Code != http.StatusOK || decodeBody(t, w)["nickName"] != "Babs" {
+		t.Errorf("after a patch: got status %d, want %d with the patched user", w.Code, http.StatusOK)
+	}
+}
+
+func TestConcurrentPatchStaleVersion(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	etag := serve(server, http.MethodGet, "/Users/"+id, "").Header().Get("Etag")
+
+	// both clients read the same version, the second one patches after the first
+	first := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`), "If-Match", etag)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first patch: got status %d, want %d: %s", first.Code, http.StatusOK, first.Body.String())
+	}
+	second := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "Barbara"}]`), "If-Match", etag)
+	if second.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale patch: got status %d, want %d: %s", second.Code, http.StatusPreconditionFailed, second.Body.String())
+	}
+	if got := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))["nickName"]; got != "Babs" {
+		t.Errorf("got nickName %v, want the first patch's Babs", got)
+	}
+
+	// of patches racing with the same version exactly one wins
+	etag = first.Header().Get("Etag")
+	const n = 10
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := patchBody(fmt.Sprintf(`[{"op": "replace", "path": "nickName", "value": "nick%d"}]`, i))
+			codes <- serve(server, http.MethodPatch, "/Users/"+id, body, "If-Match", etag).Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusPreconditionFailed] != n-1 {
+		t.Errorf("got status counts %v, want one 200 and %d 412", counts, n-1)
+	}
+}
+
+func TestWeakETags(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"strong", nil, `"1"`},
+		{"weak", []Option{WithWeakETags()}, `W/"1"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, newTestUserHandler(test.opts...), newTestGroupHandler())
+			h := ConditionalGet(server)
+			id := mustCreate(t, h, "/Users", `{"userName": "bjensen"}`)
+
+			w := serve(h, http.MethodGet, "/Users/"+id, "")
+			if got := w.Header().Get("Etag"); got != test.want {
+				t.Errorf("got ETag %s, want %s", got, test.want)
+			}
+			meta, _ := decodeBody(t, w)["meta"].(map[string]interface{})
+			if meta["version"] != test.want {
+				t.Errorf("got meta.version %v, want %s", meta["version"], test.want)
+			}
+
+			// the weak comparison ignores the W/ prefix, either form of the tag matches
+			for _, etag := range []string{`"1"`, `W/"1"`} {
+				if w := serve(h, http.MethodGet, "/Users/"+id, "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+					t.Errorf("If-None-Match %s: got status %d, want %d", etag, w.Code, http.StatusNotModified)
+				}
+			}
+			w = serve(h, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`), "If-Match", `W/"1"`)
+			if w.Code != http.StatusOK {
+				t.Errorf("If-Match weak: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			w = serve(h, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "B"}]`), "If-Match", `"2"`)
+			if w.Code != http.StatusOK {
+				t.Errorf("If-Match strong: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			for _, etag := range []string{`"1"`, `W/"1"`} {
+				if w := serve(h, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "C"}]`), "If-Match", etag); w.Code != http.StatusPreconditionFailed {
+					t.Errorf("stale If-Match %s: got status %d, want %d", etag, w.Code, http.StatusPreconditionFailed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/optional"
+	"github.com/sirupsen/logrus"
+)
+
+// externalID returns the externalId of a resource, trimmed of surrounding whitespace. Some clients send it as a
+// number or nest it in a schema extension, e.g. under "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User".
+func externalID(attributes scim.ResourceAttributes) optional.String {
+	v, ok := rawExternalID(attributes)
+	if !ok {
+		return optional.String{}
+	}
+	if s, ok := externalIDString(v); ok {
+		return optional.NewString(s)
+	}
+	return optional.String{}
+}
+
+// warnUnusableExternalID logs if the resource has an externalId that externalID can't return, e.g. an object or an
+// empty string, so it is dropped from responses.
+func warnUnusableExternalID(log *logrus.Entry, attributes scim.ResourceAttributes) {
+	v, ok := rawExternalID(attributes)
+	if !ok {
+		return
+	}
+	if _, ok := externalIDString(v); !ok {
+		log.Warnf("Ignoring unusable externalId %#v", v)
+	}
+}
+
+// rawExternalID returns the value of the externalId attribute, looking into schema extensions if there is none at the
+// top level.
+func rawExternalID(attributes scim.ResourceAttributes) (interface{}, bool) {
+	if k, ok := attributeKey(attributes, "externalId"); ok {
+		return attributes[k], true
+	}
+	for k, v := range attributes {
+		extension, ok := v.(map[string]interface{})
+		if !ok || !strings.HasPrefix(strings.ToLower(k), "urn:") {
+			continue
+		}
+		if k, ok := attributeKey(extension, "externalId"); ok {
+			return extension[k], true
+		}
+	}
+	return nil, false
+}
+
+// externalIDString converts a string, number or boolean externalId to a string, ok is false for any other value or if
+// it is blank.
+func externalIDString(v interface{}) (string, bool) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return "", false
+	}
+
+	s = strings.TrimSpace(s)
+	return s, s != ""
+}
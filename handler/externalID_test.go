@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elimity-com/scim"
+)
+
+func TestExternalID(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes scim.ResourceAttributes
+		want       string
+		wantOK     bool
+	}{
+		{"string", scim.ResourceAttributes{"externalId": "701984"}, "701984", true},
+		{"padded string", scim.ResourceAttributes{"externalId": "  701984 "}, "701984", true},
+		{"mixed case key", scim.ResourceAttributes{"ExternalID": "701984"}, "701984", true},
+		{"json number", scim.ResourceAttributes{"externalId": json.Number("701984")}, "701984", true},
+		{"float", scim.ResourceAttributes{"externalId": float64(701984)}, "701984", true},
+		{"int", scim.ResourceAttributes{"externalId": 701984}, "701984", true},
+		{"extension", scim.ResourceAttributes{
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"externalId": "701984"},
+		}, "701984", true},
+		{"top level before extension", scim.ResourceAttributes{
+			"externalId": "1",
+			"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"externalId": "2"},
+		}, "1", true},
+		{"absent", scim.ResourceAttributes{"userName": "bjensen"}, "", false},
+		{"empty", scim.ResourceAttributes{"externalId": " "}, "", false},
+		{"null", scim.ResourceAttributes{"externalId": nil}, "", false},
+		{"object", scim.ResourceAttributes{"externalId": map[string]interface{}{"value": "701984"}}, "", false},
+		{"not an extension", scim.ResourceAttributes{"name": map[string]interface{}{"externalId": "701984"}}, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := externalID(test.attributes)
+			if got.Present() != test.wantOK || got.Value() != test.want {
+				t.Errorf("got %q (present %v), want %q (present %v)", got.Value(), got.Present(), test.want, test.wantOK)
+			}
+		})
+	}
+}
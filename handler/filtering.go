@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/schema"
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+type filterKey struct{}
+
+// CommonAttributeFilters serves list requests filtering by the id or meta of resources, e.g. the delta sync filter
+// `meta.lastModified gt "2024-01-01T00:00:00Z"`. The library rejects filters on attributes its schemas don't declare,
+// which these common attributes are not, so such filters are passed to the handlers in the request context instead.
+func CommonAttributeFilters(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := r.URL.Query().Get("filter")
+		if r.Method != http.MethodGet || f == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		expr, err := filter.Parse(f)
+		if err != nil || !referencesCommonAttributes(expr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(context.WithValue(r.Context(), filterKey{}, f))
+		query := r.URL.Query()
+		query.Del("filter")
+		r.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listFilter returns the filter of a list request.
+func listFilter(r *http.Request) string {
+	if f, ok := r.Context().Value(filterKey{}).(string); ok {
+		return f
+	}
+	return r.URL.Query().Get("filter")
+}
+
+// referencesCommonAttributes reports whether expr compares the id or meta of resources.
+func referencesCommonAttributes(expr filter.Expression) bool {
+	var path string
+	switch e := expr.(type) {
+	case *filter.LogicalExpression:
+		return referencesCommonAttributes(e.Left) || referencesCommonAttributes(e.Right)
+	case *filter.NotExpression:
+		return referencesCommonAttributes(e.Expression)
+	case *filter.ValuePathExpression:
+		path = e.AttributePath
+	case *filter.AttributeExpression:
+		path = e.AttributePath
+	}
+	name := strings.SplitN(path, ".", 2)[0]
+	return strings.EqualFold(name, "id") || strings.EqualFold(name, "meta")
+}
+
+// applyCaseExact marks the comparisons of expr on attributes of attrs whose caseExact characteristic is true, such as
+// externalId, and on the id as case exact, so the filter compares the values of all other attributes
+// case-insensitively. attrs are the attributes of the schema with the given id, paths may be prefixed with it, or the
+// sub-attributes of the complex attribute of a value filter.
+func applyCaseExact(schemaID string, attrs schema.Attributes, expr filter.Expression) {
+	switch e := expr.(type) {
+	case *filter.LogicalExpression:
+		applyCaseExact(schemaID, attrs, e.Left)
+		applyCaseExact(schemaID, attrs, e.Right)
+	case *filter.NotExpression:
+		applyCaseExact(schemaID, attrs, e.Expression)
+	case *filter.ValuePathExpression:
+		if attr, ok := lookupAttribute(schemaID, attrs, e.AttributePath); ok {
+			applyCaseExact("", attr.SubAttributes(), e.Filter)
+		}
+	case *filter.AttributeExpression:
+		if strings.EqualFold(e.AttributePath, "id") {
+			// see RFC 7643, section 3.1
+			e.CaseExact = true
+			return
+		}
+		if attr, ok := lookupAttribute(schemaID, attrs, e.AttributePath); ok {
+			e.CaseExact = attr.CaseExact()
+		}
+	}
+}
+
+// lookupAttribute returns the attribute or sub-attribute of attrs a path such as "name.givenName" refers to.
+func lookupAttribute(schemaID string, attrs schema.Attributes, path string) (schema.CoreAttribute, bool) {
+	if schemaID != "" && len(path) > len(schemaID) && strings.EqualFold(path[:len(schemaID)+1], schemaID+":") {
+		path = path[len(schemaID)+1:]
+	}
+	name, sub, hasSub := strings.Cut(path, ".")
+	attr, ok := attrs.ContainsAttribute(name)
+	if !ok || !hasSub {
+		return attr, ok
+	}
+	return attr.SubAttributes().ContainsAttribute(sub)
+}
+
+// filterAttributes returns the attributes of record a filter is evaluated against, the given attributes of the
+// resource plus its id and meta.
+func filterAttributes(record Record, attributes scim.ResourceAttributes, resourceType string) map[string]interface{} {
+	result := make(map[string]interface{}, len(attributes)+2)
+	for k, v := range attributes {
+		result[k] = v
+	}
+	result["id"] = record.ID
+
+	meta := map[string]interface{}{"resourceType": resourceType}
+	for _, k := range []string{"created", "lastModified", "version"} {
+		if v, ok := record.Meta[k]; ok {
+			meta[k] = v
+		}
+	}
+	result["meta"] = meta
+	return result
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/optional"
+	"github.com/elimity-com/scim/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// testUserSchema returns a User schema with the attributes the tests exercise.
+func testUserSchema() schema.Schema {
+	return schema.Schema{
+		ID:   schema.UserSchema,
+		Name: optional.NewString("User"),
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:       "userName",
+				Required:   true,
+				Uniqueness: schema.AttributeUniquenessServer(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				CaseExact:  true,
+				Name:       "externalId",
+				Uniqueness: schema.AttributeUniquenessServer(),
+			})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				Name: "name",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{Name: "formatted"}),
+					schema.SimpleStringParams(schema.StringParams{Name: "familyName"}),
+					schema.SimpleStringParams(schema.StringParams{Name: "givenName"}),
+				},
+			}),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name: "nickName",
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Mutability: schema.AttributeMutabilityWriteOnly(),
+				Name:       "password",
+				Returned:   schema.AttributeReturnedNever(),
+			})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				MultiValued: true,
+				Name:        "emails",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{Name: "value", Required: true}),
+					schema.SimpleStringParams(schema.StringParams{
+						CanonicalValues: []string{"work", "home", "other"},
+						Name:            "type",
+					}),
+					schema.SimpleBooleanParams(schema.BooleanParams{Name: "primary"}),
+				},
+			}),
+			schema.SimpleCoreAttribute(schema.SimpleBooleanParams(schema.BooleanParams{
+				Name: "active",
+			})),
+		},
+	}
+}
+
+// testGroupSchema returns a Group schema with a display name and members.
+func testGroupSchema() schema.Schema {
+	return schema.Schema{
+		ID:   schema.GroupSchema,
+		Name: optional.NewString("Group"),
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:     "displayName",
+				Required: true,
+			})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				MultiValued: true,
+				Name:        "members",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{
+						Mutability: schema.AttributeMutabilityImmutable(),
+						Name:       "value",
+					}),
+					schema.SimpleStringParams(schema.StringParams{
+						Mutability: schema.AttributeMutabilityImmutable(),
+						Name:       "display",
+					}),
+				},
+			}),
+		},
+	}
+}
+
+// testLogger returns a logger discarding its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+// newTestUserHandler returns a handler of users kept in memory.
+func newTestUserHandler(opts ...Option) SchemaResourceHandler {
+	return NewSchemaResourceHandler(testLogger(), "User", NewMemoryStore(), testUserSchema(), 100, opts...)
+}
+
+// newTestGroupHandler returns a handler of groups kept in memory.
+func newTestGroupHandler(opts ...Option) SchemaResourceHandler {
+	return NewSchemaResourceHandler(testLogger(), "Group", NewMemoryStore(), testGroupSchema(), 100, opts...)
+}
+
+// newTestServer returns a SCIM server serving the users of users and the groups of groups relative to /.
+func newTestServer(t testing.TB, users, groups SchemaResourceHandler) http.Handler {
+	t.Helper()
+
+	server, err := scim.NewServer(&scim.ServerArgs{
+		ServiceProviderConfig: &scim.ServiceProviderConfig{SupportFiltering: true, SupportPatch: true},
+		ResourceTypes: []scim.ResourceType{
+			{
+				ID:       optional.NewString("User"),
+				Name:     "User",
+				Endpoint: "/Users",
+				Schema:   testUserSchema(),
+				Handler:  users,
+			},
+			{
+				ID:       optional.NewString("Group"),
+				Name:     "Group",
+				Endpoint: "/Groups",
+				Schema:   testGroupSchema(),
+				Handler:  groups,
+			},
+		},
+	}, scim.WithLogger(testLogger()))
+	if err != nil {
+		t.Fatalf("failed to create SCIM server: %v", err)
+	}
+	return server
+}
+
+// serve sends a request with the given body, if not empty, to h and returns the response.
+func serve(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/scim+json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody decodes the JSON body of a response.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	d.UseNumber()
+	if err := d.Decode(&body); err != nil {
+		t.Fatalf("failed to decode response body %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// mustCreate creates a resource with the given JSON body on h and returns its id.
+func mustCreate(t *testing.T, h http.Handler, endpoint, body string) string {
+	t.Helper()
+
+	w := serve(h, http.MethodPost, endpoint, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST %s: got status %d, want %d: %s", endpoint, w.Code, http.StatusCreated, w.Body.String())
+	}
+	id, _ := decodeBody(t, w)["id"].(string)
+	return id
+}
+
+// testRequest returns a request to call the handler methods with directly.
+func testRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/", nil)
+}
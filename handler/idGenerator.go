@@ -0,0 +1,15 @@
+package handler
+
+import "github.com/google/uuid"
+
+// IDGenerator generates the ids of new resources.
+type IDGenerator interface {
+	NewID() string
+}
+
+// uuidGenerator generates random UUIDs.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/schema"
+)
+
+// Verify sequentialIDGenerator is of type IDGenerator
+var _ IDGenerator = &sequentialIDGenerator{}
+
+// sequentialIDGenerator generates the ids "1", "2", "3" and so on, so tests can predict the ids of resources.
+type sequentialIDGenerator struct {
+	last atomic.Int64
+}
+
+func (g *sequentialIDGenerator) NewID() string {
+	return strconv.FormatInt(g.last.Add(1), 10)
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	h := newTestUserHandler(WithIDGenerator(&sequentialIDGenerator{}))
+	r := testRequest()
+
+	for i, userName := range []string{"bjensen", "jsmith", "mjones"} {
+		resource, err := h.Create(r, scim.ResourceAttributes{"userName": userName})
+		if err != nil {
+			t.Fatalf("Create %s: %v", userName, err)
+		}
+		if want := strconv.Itoa(i + 1); resource.ID != want {
+			t.Errorf("Create %s: got id %q, want %q", userName, resource.ID, want)
+		}
+	}
+}
+
+func TestSequentialIDGeneratorExistingID(t *testing.T) {
+	h := newTestUserHandler(WithIDGenerator(&sequentialIDGenerator{}))
+	if err := h.store.Put(Record{ID: "1", Attributes: scim.ResourceAttributes{"userName": "bjensen"}, Meta: map[string]string{}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, err := h.Create(testRequest(), scim.ResourceAttributes{"userName": "jsmith"}); err == nil {
+		t.Error("Create: got no error for a generated id that exists")
+	}
+}
+
+func TestSequentialIDGeneratorRestore(t *testing.T) {
+	h := newTestUserHandler(WithIDGenerator(&sequentialIDGenerator{}))
+
+	// resources without an id get one of the generator, the others keep theirs
+	err := h.Restore([]scim.Resource{
+		{Attributes: scim.ResourceAttributes{"userName": "bjensen"}},
+		{ID: "2819c223", Attributes: scim.ResourceAttributes{"userName": "jsmith"}},
+		{Attributes: scim.ResourceAttributes{"userName": "mjones"}},
+	})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	for id, userName := range map[string]string{"1": "bjensen", "2819c223": "jsmith", "2": "mjones"} {
+		if got := mustGet(t, h, id); got.Attributes["userName"] != userName {
+			t.Errorf("got userName %v for id %s, want %s", got.Attributes["userName"], id, userName)
+		}
+	}
+}
+
+func TestUUIDGeneratorDistinctIDs(t *testing.T) {
+	// without unique attributes creates don't list the existing users, which would make this test quadratic
+	sc := testUserSchema()
+	sc.Attributes = []schema.CoreAttribute{
+		schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{Name: "userName", Required: true})),
+	}
+	s := NewMemoryStore()
+	h := NewSchemaResourceHandler(testLogger(), "User", s, sc, 100)
+	r := testRequest()
+
+	const n = 10000
+	ids := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		resource, err := h.Create(r, scim.ResourceAttributes{"userName": "user" + strconv.Itoa(i)})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids[resource.ID] = struct{}{}
+	}
+
+	if len(ids) != n {
+		t.Errorf("got %d distinct ids, want %d", len(ids), n)
+	}
+	if count, err := Count(s); err != nil || count != n {
+		t.Errorf("got %d stored users (err %v), want %d", count, err, n)
+	}
+}
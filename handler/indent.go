@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Indent pretty-prints the JSON responses of next, e.g. for reading curl output. Other responses are passed on as is.
+func Indent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, r)
+
+		body := rec.body.Bytes()
+		var indented bytes.Buffer
+		if isJSON(rec.Header().Get("Content-Type")) && json.Indent(&indented, body, "", "  ") == nil {
+			body = append(indented.Bytes(), '\n')
+		}
+
+		if rec.Header().Get("Content-Length") != "" {
+			rec.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		rec.writeTo(w, body)
+	})
+}
+
+// isJSON reports whether the media type of contentType is JSON, e.g. application/scim+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "application/scim+json"
+}
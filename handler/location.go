@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Locations rewrites the meta.location of the resources in the responses of next, which the library reports relative
+// to the SCIM endpoint, e.g. `Users/2819c223`, to absolute URLs below baseURL, e.g.
+// `https://example.com/scim/v2/Users/2819c223`. The location of a created resource is set as Location header as well.
+func Locations(baseURL string, next http.Handler) http.Handler {
+	baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, r)
+
+		body := rec.body.Bytes()
+		if rec.status == http.StatusOK || rec.status == http.StatusCreated {
+			if b, location, ok := absoluteLocations(baseURL, body); ok {
+				body = b
+				if rec.status == http.StatusCreated {
+					rec.Header().Set("Location", location)
+				}
+			}
+		}
+		rec.writeTo(w, body)
+	})
+}
+
+// absoluteLocations prefixes the meta.location of the resource or list response in body with baseURL and returns the
+// new body and the location of the resource. It reports false if body contains no relative location.
+func absoluteLocations(baseURL string, body []byte) ([]byte, string, bool) {
+	var response map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&response); err != nil {
+		return nil, "", false
+	}
+
+	location, ok := absoluteLocation(baseURL, response)
+	if resources, isList := response["Resources"].([]interface{}); isList {
+		for _, resource := range resources {
+			if resource, isMap := resource.(map[string]interface{}); isMap {
+				if _, rewritten := absoluteLocation(baseURL, resource); rewritten {
+					ok = true
+				}
+			}
+		}
+	}
+	if !ok {
+		return nil, "", false
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		return nil, "", false
+	}
+	return b, location, true
+}
+
+// absoluteLocation prefixes the relative meta.location of resource with baseURL.
+func absoluteLocation(baseURL string, resource map[string]interface{}) (string, bool) {
+	meta, _ := resource["meta"].(map[string]interface{})
+	location, _ := meta["location"].(string)
+	if location == "" || strings.Contains(location, "://") {
+		return "", false
+	}
+	meta["location"] = baseURL + strings.TrimPrefix(location, "/")
+	return meta["location"].(string), true
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// Verify membershipIndex is of type FilterStore, WalkStore and CountStore
+var _ FilterStore = &membershipIndex{}
+var _ WalkStore = &membershipIndex{}
+var _ CountStore = &membershipIndex{}
+
+// membershipIndex keeps a reverse index from member values to the groups containing them, so a filter such as
+// `members eq "<userId>"` doesn't have to scan every group. The index is built from the records of the store on
+// creation and kept up to date on writes through the index, it assumes no other process writes to the store.
+type membershipIndex struct {
+	Store
+	// mu serializes writes so the index reflects the order in which they were applied to the store
+	mu sync.RWMutex
+	// groups maps a lower-cased member value to the ids of the groups containing it, the filter compares member
+	// values case-insensitively unless they are case exact
+	groups map[string]map[string]struct{}
+	// members maps a group id to its member values
+	members map[string][]string
+}
+
+// NewMembershipIndex returns a FilterStore serving filters on the members of the groups in s from an index.
+func NewMembershipIndex(s Store) (FilterStore, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &membershipIndex{
+		Store:   s,
+		groups:  make(map[string]map[string]struct{}),
+		members: make(map[string][]string),
+	}
+	for _, record := range records {
+		i.index(record)
+	}
+	return i, nil
+}
+
+func (i *membershipIndex) Put(record Record) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.Put(record); err != nil {
+		return err
+	}
+	i.index(record)
+	return nil
+}
+
+func (i *membershipIndex) Delete(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.Delete(id); err != nil {
+		return err
+	}
+	i.unindex(id)
+	return nil
+}
+
+func (i *membershipIndex) DeleteAll() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.Store.DeleteAll(); err != nil {
+		return err
+	}
+	i.groups = make(map[string]map[string]struct{})
+	i.members = make(map[string][]string)
+	return nil
+}
+
+func (i *membershipIndex) Patch(id string, fn func(record *Record) error) (Record, error) {
+	return i.PatchWithVersion(id, "", fn)
+}
+
+func (i *membershipIndex) PatchWithVersion(id, expectedVersion string, fn func(record *Record) error) (Record, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	record, err := i.Store.PatchWithVersion(id, expectedVersion, fn)
+	if err != nil {
+		return Record{}, err
+	}
+	i.index(record)
+	return record, nil
+}
+
+// ListMatching returns the groups containing the member if expr requires one, e.g. `members eq "<userId>"` or
+// `displayName sw "eng" and members.value eq "<userId>"`, otherwise it falls back to the store.
+func (i *membershipIndex) ListMatching(expr filter.Expression) ([]Record, error) {
+	member, ok := requiredMember(expr)
+	if !ok {
+		return listMatching(i.Store, expr)
+	}
+
+	member = strings.ToLower(member)
+	i.mu.RLock()
+	ids := make([]string, 0, len(i.groups[member]))
+	for id := range i.groups[member] {
+		ids = append(ids, id)
+	}
+	i.mu.RUnlock()
+
+	records := make([]Record, 0, len(ids))
+	for _, id := range ids {
+		record, err := i.Store.Get(id)
+		if err == ErrNotFound {
+			// deleted since the index was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Walk lets the store pass its records one at a time if it can.
+func (i *membershipIndex) Walk(fn func(record Record) error) error {
+	return walk(i.Store, fn)
+}
+
+// Count lets the store count its records if it can.
+func (i *membershipIndex) Count() (int, error) {
+	return Count(i.Store)
+}
+
+// index replaces the indexed members of the group with those of record. The caller holds mu.
+func (i *membershipIndex) index(record Record) {
+	i.unindex(record.ID)
+
+	values := memberValues(record)
+	for _, value := range values {
+		if i.groups[value] == nil {
+			i.groups[value] = make(map[string]struct{})
+		}
+		i.groups[value][record.ID] = struct{}{}
+	}
+	i.members[record.ID] = values
+}
+
+// unindex removes the group with the given id from the index. The caller holds mu.
+func (i *membershipIndex) unindex(id string) {
+	for _, value := range i.members[id] {
+		delete(i.groups[value], id)
+		if len(i.groups[value]) == 0 {
+			delete(i.groups, value)
+		}
+	}
+	delete(i.members, id)
+}
+
+// memberValues returns the lower-cased values of the members of a group.
+func memberValues(record Record) []string {
+	var values []string
+	members, _ := filter.Lookup(record.Attributes, "members.value")
+	list, _ := members.([]interface{})
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			values = append(values, strings.ToLower(s))
+		}
+	}
+	return values
+}
+
+// requiredMember returns the member value every group matching expr must contain, i.e. the value of a
+// `members eq` or `members.value eq` comparison that is not part of an "or" or "not".
+func requiredMember(expr filter.Expression) (string, bool) {
+	switch e := expr.(type) {
+	case *filter.LogicalExpression:
+		if e.Operator != filter.And {
+			return "", false
+		}
+		if member, ok := requiredMember(e.Left); ok {
+			return member, true
+		}
+		return requiredMember(e.Right)
+	case *filter.AttributeExpression:
+		if e.Operator != filter.Equal {
+			return "", false
+		}
+		if !strings.EqualFold(e.AttributePath, "members") && !strings.EqualFold(e.AttributePath, "members.value") {
+			return "", false
+		}
+		member, ok := e.Value.(string)
+		return member, ok
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// listGroupNames returns the displayNames of the groups listed by GET /Groups with the given filter, sorted.
+func listGroupNames(t *testing.T, h http.Handler, filter string) []string {
+	t.Helper()
+
+	w := serve(h, http.MethodGet, "/Groups?sortBy=displayName&filter="+url.QueryEscape(filter), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("filter %s: got status %d, want %d: %s", filter, w.Code, http.StatusOK, w.Body.String())
+	}
+	resources, _ := decodeBody(t, w)["Resources"].([]interface{})
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, resource.(map[string]interface{})["displayName"].(string))
+	}
+	return names
+}
+
+func TestMembershipIndex(t *testing.T) {
+	store, err := NewMembershipIndex(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewMembershipIndex: %v", err)
+	}
+	groups := NewSchemaResourceHandler(testLogger(), "Group", store, testGroupSchema(), 100)
+	server := newTestServer(t, newTestUserHandler(), groups)
+
+	bjensen := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	jsmith := mustCreate(t, server, "/Users", `{"userName": "jsmith"}`)
+	admins := mustCreate(t, server, "/Groups", `{"displayName": "Admins", "members": [{"value": "`+bjensen+`"}]}`)
+	mustCreate(t, server, "/Groups", `{"displayName": "Tour Guides", "members": [{"value": "`+jsmith+`"}, {"value": "`+bjensen+`"}]}`)
+	mustCreate(t, server, "/Groups", `{"displayName": "Drivers", "members": [{"value": "`+jsmith+`"}]}`)
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`members.value eq "` + bjensen + `"`, []string{"Admins", "Tour Guides"}},
+		{`members eq "` + bjensen + `"`, []string{"Admins", "Tour Guides"}},
+		{`members.value eq "` + jsmith + `" and displayName sw "T"`, []string{"Tour Guides"}},
+		// not served from the index
+		{`members.value eq "` + bjensen + `" or displayName eq "Drivers"`, []string{"Admins", "Drivers", "Tour Guides"}},
+		{`members.value eq "unknown"`, []string{}},
+	}
+	for _, test := range tests {
+		if got := listGroupNames(t, server, test.filter); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("filter %s: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+
+	// writes keep the index up to date
+	if w := serve(server, http.MethodDelete, "/Groups/"+admins, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got, want := listGroupNames(t, server, `members.value eq "`+bjensen+`"`), []string{"Tour Guides"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after DELETE: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"sync"
+
+	"github.com/elimity-com/scim"
+)
+
+// Verify memoryStore is of type CountStore
+var _ CountStore = &memoryStore{}
+
+// memoryStore keeps records in a map. Records are copied in and out so callers can't mutate stored state.
+type memoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+func (s *memoryStore) Get(id string) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return copyRecord(record), nil
+}
+
+func (s *memoryStore) List() ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, copyRecord(record))
+	}
+	return records, nil
+}
+
+func (s *memoryStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.records), nil
+}
+
+func (s *memoryStore) Put(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.ID] = copyRecord(record)
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.records, id)
+	return nil
+}
+
+func (s *memoryStore) DeleteAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = make(map[string]Record)
+	return nil
+}
+
+func (s *memoryStore) Patch(id string, fn func(record *Record) error) (Record, error) {
+	return s.PatchWithVersion(id, "", fn)
+}
+
+func (s *memoryStore) PatchWithVersion(id, expectedVersion string, fn func(record *Record) error) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	if !versionMatches(expectedVersion, stored.Meta["version"]) {
+		return Record{}, ErrVersionMismatch
+	}
+
+	record := copyRecord(stored)
+	if err := fn(&record); err != nil {
+		return Record{}, err
+	}
+	s.records[id] = copyRecord(record)
+	return record, nil
+}
+
+func (s *memoryStore) Ping() error {
+	return nil
+}
+
+func copyRecord(record Record) Record {
+	meta := make(map[string]string, len(record.Meta))
+	for k, v := range record.Meta {
+		meta[k] = v
+	}
+
+	return Record{
+		ID:         record.ID,
+		Attributes: copyAttributes(record.Attributes),
+		Meta:       meta,
+	}
+}
+
+// copyValue deep copies the maps and slices of a decoded JSON value.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, e := range v {
+			arr[i] = copyValue(e)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// copyAttributes deep copies resource attributes.
+func copyAttributes(attributes scim.ResourceAttributes) scim.ResourceAttributes {
+	return copyValue(map[string]interface{}(attributes)).(map[string]interface{})
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elimity-com/scim"
+)
+
+// testStore exercises the methods of an empty Store.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+
+	if _, err := s.Get("1"); err != ErrNotFound {
+		t.Fatalf("Get of a missing record: got %v, want ErrNotFound", err)
+	}
+	for _, id := range []string{"1", "2"} {
+		err := s.Put(Record{ID: id, Attributes: scim.ResourceAttributes{"userName": "user" + id}, Meta: map[string]string{"version": "1"}})
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	record, err := s.Get("1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if record.ID != "1" || record.Attributes["userName"] != "user1" || record.Meta["version"] != "1" {
+		t.Errorf("Get: got %+v", record)
+	}
+	if records, err := s.List(); err != nil || len(records) != 2 {
+		t.Errorf("List: got %d records (err %v), want 2", len(records), err)
+	}
+	if count, err := Count(s); err != nil || count != 2 {
+		t.Errorf("Count: got %d (err %v), want 2", count, err)
+	}
+
+	patched, err := s.Patch("1", func(record *Record) error {
+		record.Attributes["nickName"] = "Babs"
+		record.Meta["version"] = "2"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if patched.Attributes["nickName"] != "Babs" {
+		t.Errorf("Patch: got %+v", patched)
+	}
+	if record, _ := s.Get("1"); record.Attributes["nickName"] != "Babs" || record.Meta["version"] != "2" {
+		t.Errorf("Get after Patch: got %+v", record)
+	}
+
+	failed := errors.New("failed")
+	if _, err := s.Patch("1", func(record *Record) error {
+		record.Attributes["nickName"] = "Barbara"
+		return failed
+	}); err != failed {
+		t.Errorf("Patch failing: got %v, want %v", err, failed)
+	}
+	if record, _ := s.Get("1"); record.Attributes["nickName"] != "Babs" {
+		t.Errorf("Get after a failed Patch: got nickName %v, want unchanged", record.Attributes["nickName"])
+	}
+	if _, err := s.Patch("3", func(*Record) error { return nil }); err != ErrNotFound {
+		t.Errorf("Patch of a missing record: got %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.PatchWithVersion("1", `"1"`, func(record *Record) error {
+		record.Attributes["nickName"] = "Barbara"
+		return nil
+	}); err != ErrVersionMismatch {
+		t.Errorf("PatchWithVersion of a stale version: got %v, want ErrVersionMismatch", err)
+	}
+	if record, _ := s.Get("1"); record.Attributes["nickName"] != "Babs" {
+		t.Errorf("Get after a stale PatchWithVersion: got nickName %v, want unchanged", record.Attributes["nickName"])
+	}
+	if _, err := s.PatchWithVersion("1", `"1", W/"2"`, func(record *Record) error {
+		record.Attributes["nickName"] = "Barbara"
+		record.Meta["version"] = "3"
+		return nil
+	}); err != nil {
+		t.Fatalf("PatchWithVersion: %v", err)
+	}
+	if record, _ := s.Get("1"); record.Attributes["nickName"] != "Barbara" || record.Meta["version"] != "3" {
+		t.Errorf("Get after PatchWithVersion: got %+v", record)
+	}
+	if _, err := s.PatchWithVersion("3", "*", func(*Record) error { return nil }); err != ErrNotFound {
+		t.Errorf("PatchWithVersion of a missing record: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.Delete("1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete("1"); err != ErrNotFound {
+		t.Errorf("Delete of a missing record: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteAll(); err != nil {
+		t.Fatalf("DeleteAll: %v", err)
+	}
+	if records, err := s.List(); err != nil || len(records) != 0 {
+		t.Errorf("List after DeleteAll: got %d records (err %v), want 0", len(records), err)
+	}
+	if err := s.Ping(); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreCopiesRecords(t *testing.T) {
+	s := NewMemoryStore()
+	emails := []interface{}{map[string]interface{}{"value": "bjensen@example.com"}}
+	attributes := scim.ResourceAttributes{"userName": "bjensen", "emails": emails}
+	if err := s.Put(Record{ID: "1", Attributes: attributes, Meta: map[string]string{}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	attributes["userName"] = "jsmith"
+	emails[0].(map[string]interface{})["value"] = "jsmith@example.com"
+	record, _ := s.Get("1")
+	record.Attributes["nickName"] = "Babs"
+
+	record, _ = s.Get("1")
+	if record.Attributes["userName"] != "bjensen" || record.Attributes["nickName"] != nil {
+		t.Errorf("got %v, want the attributes as put", record.Attributes)
+	}
+	if v := record.Attributes["emails"].([]interface{})[0].(map[string]interface{})["value"]; v != "bjensen@example.com" {
+		t.Errorf("got email %v, want the email as put", v)
+	}
+}
+
+func TestHandlerStore(t *testing.T) {
+	s := NewMemoryStore()
+	h := NewSchemaResourceHandler(testLogger(), "User", s, testUserSchema(), 100)
+	r := testRequest()
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	record, err := s.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Get from the store: %v", err)
+	}
+	if record.Attributes["userName"] != "bjensen" || record.Meta["version"] == "" {
+		t.Errorf("got stored record %+v", record)
+	}
+
+	// records put in the store are served by the handler
+	if err := s.Put(Record{ID: "2", Attributes: scim.ResourceAttributes{"userName": "jsmith"}, Meta: map[string]string{"version": "1"}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := h.Get(r, "2")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Attributes["userName"] != "jsmith" {
+		t.Errorf("got userName %v, want jsmith", got.Attributes["userName"])
+	}
+
+	if err := h.Delete(r, created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(created.ID); err != ErrNotFound {
+		t.Errorf("Get from the store after Delete: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	"github.com/elimity-com/scim/schema"
+)
+
+// keepUnmodifiable copies the readOnly and immutable attributes of s and of its extensions that are missing from
+// attributes from previous, e.g. a replace does not have to repeat them and the library drops readOnly attributes from
+// requests.
+func keepUnmodifiable(s schema.Schema, extensions []schema.Schema, previous, attributes scim.ResourceAttributes) {
+	keepUnmodifiableAttributes(s.Attributes, previous, attributes)
+	for _, ext := range extensions {
+		pk, ok := attributeKey(previous, ext.ID)
+		if !ok {
+			continue
+		}
+		before, _ := previous[pk].(map[string]interface{})
+		k, ok := attributeKey(attributes, ext.ID)
+		if !ok {
+			k = pk
+		}
+		after, _ := attributes[k].(map[string]interface{})
+		if after == nil {
+			after = make(map[string]interface{})
+		}
+		keepUnmodifiableAttributes(ext.Attributes, before, after)
+		if len(after) > 0 {
+			attributes[k] = after
+		}
+	}
+}
+
+// keepUnmodifiableAttributes copies the readOnly and immutable attributes of attrs that are missing from values from
+// previous, including the sub-attributes of singular complex attributes present in both.
+func keepUnmodifiableAttributes(attrs schema.Attributes, previous, values map[string]interface{}) {
+	for _, attr := range attrs {
+		k, ok := attributeKey(previous, attr.Name())
+		if !ok {
+			continue
+		}
+		vk, present := attributeKey(values, attr.Name())
+
+		switch attr.Mutability() {
+		case "readOnly", "immutable":
+			if !present {
+				values[k] = previous[k]
+			}
+			continue
+		}
+		if present && attr.HasSubAttributes() && !attr.MultiValued() {
+			before, _ := previous[k].(map[string]interface{})
+			if after, ok := values[vk].(map[string]interface{}); ok {
+				keepUnmodifiableAttributes(attr.SubAttributes(), before, after)
+			}
+		}
+	}
+}
+
+// checkMutability returns a mutability error if attributes, the result of a replace or patch of previous, modify a
+// readOnly attribute of s or of its extensions or an immutable attribute that was already set. Sub-attributes are
+// checked for singular complex attributes only, the elements of multi-valued attributes can't be matched to their
+// previous values.
+func checkMutability(s schema.Schema, extensions []schema.Schema, previous, attributes scim.ResourceAttributes) error {
+	name, mutability, ok := modifiedAttribute(s.Attributes, previous, attributes)
+	for _, ext := range extensions {
+		if ok {
+			break
+		}
+		var before, after map[string]interface{}
+		if k, found := attributeKey(previous, ext.ID); found {
+			before, _ = previous[k].(map[string]interface{})
+		}
+		if k, found := attributeKey(attributes, ext.ID); found {
+			after, _ = attributes[k].(map[string]interface{})
+		}
+		if name, mutability, ok = modifiedAttribute(ext.Attributes, before, after); ok {
+			name = ext.ID + ":" + name
+		}
+	}
+	if !ok {
+		return nil
+	}
+	scimErr := errors.ScimErrorMutability
+	scimErr.Detail = fmt.Sprintf("The attribute %s is %s and can't be modified.", name, mutability)
+	return scimErr
+}
+
+// modifiedAttribute returns the name and mutability of the first attribute of attrs that values modifies although
+// its mutability does not allow it.
+func modifiedAttribute(attrs schema.Attributes, previous, values map[string]interface{}) (string, string, bool) {
+	for _, attr := range attrs {
+		var before, after interface{}
+		if k, ok := attributeKey(previous, attr.Name()); ok {
+			before = previous[k]
+		}
+		if k, ok := attributeKey(values, attr.Name()); ok {
+			after = values[k]
+		}
+
+		switch mutability := attr.Mutability(); mutability {
+		case "readOnly":
+			if !reflect.DeepEqual(before, after) {
+				return attr.Name(), mutability, true
+			}
+		case "immutable":
+			if before != nil && !reflect.DeepEqual(before, after) {
+				return attr.Name(), mutability, true
+			}
+		}
+
+		if attr.HasSubAttributes() && !attr.MultiValued() {
+			b, _ := before.(map[string]interface{})
+			a, _ := after.(map[string]interface{})
+			if name, mutability, ok := modifiedAttribute(attr.SubAttributes(), b, a); ok {
+				return attr.Name() + "." + name, mutability, true
+			}
+		}
+	}
+	return "", "", false
+}
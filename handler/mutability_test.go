@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	"github.com/elimity-com/scim/optional"
+	"github.com/elimity-com/scim/schema"
+)
+
+// mutabilitySchema returns a User schema with a readOnly, an immutable and a complex attribute with a readOnly
+// sub-attribute.
+func mutabilitySchema() schema.Schema {
+	return schema.Schema{
+		ID:   schema.UserSchema,
+		Name: optional.NewString("User"),
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{Name: "userName", Required: true})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{Name: "nickName"})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Mutability: schema.AttributeMutabilityReadOnly(),
+				Name:       "lastLogin",
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Mutability: schema.AttributeMutabilityImmutable(),
+				Name:       "employeeNumber",
+			})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				Name: "manager",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{Name: "value"}),
+					schema.SimpleStringParams(schema.StringParams{
+						Mutability: schema.AttributeMutabilityReadOnly(),
+						Name:       "displayName",
+					}),
+				},
+			}),
+		},
+	}
+}
+
+func TestPatchMutability(t *testing.T) {
+	h := NewSchemaResourceHandler(testLogger(), "User", NewMemoryStore(), mutabilitySchema(), 100)
+	err := h.Restore([]scim.Resource{
+		{ID: "set", Attributes: scim.ResourceAttributes{
+			"userName":       "bjensen",
+			"lastLogin":      "2024-03-01T12:00:00Z",
+			"employeeNumber": "701984",
+			"manager":        map[string]interface{}{"value": "26118915", "displayName": "John Smith"},
+		}},
+		{ID: "unset", Attributes: scim.ResourceAttributes{"userName": "jsmith"}},
+	})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		operation scim.PatchOperation
+		wantErr   bool
+	}{
+		{"readOnly", "set", scim.PatchOperation{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"lastLogin": "2025-01-01T00:00:00Z"}}, true},
+		{"unset readOnly", "unset", scim.PatchOperation{Op: scim.PatchOperationAdd, Value: map[string]interface{}{"lastLogin": "2025-01-01T00:00:00Z"}}, true},
+		{"immutable", "set", scim.PatchOperation{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"employeeNumber": "1"}}, true},
+		{"unset immutable", "unset", scim.PatchOperation{Op: scim.PatchOperationAdd, Value: map[string]interface{}{"employeeNumber": "1"}}, false},
+		{"readOnly sub-attribute", "set", scim.PatchOperation{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"manager": map[string]interface{}{"value": "26118915", "displayName": "Jane Doe"}}}, true},
+		{"readWrite", "set", scim.PatchOperation{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": "Babs"}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := mustGet(t, h, test.id)
+			_, err := h.Patch(testRequest(), test.id, []scim.PatchOperation{test.operation})
+			if !test.wantErr {
+				if err != nil {
+					t.Errorf("Patch: %v", err)
+				}
+				return
+			}
+
+			scimErr, ok := err.(errors.ScimError)
+			if !ok || scimErr.Status != http.StatusBadRequest || scimErr.ScimType != errors.ScimTypeMutability {
+				t.Fatalf("Patch: got error %v, want a mutability error", err)
+			}
+			if after := mustGet(t, h, test.id); after.Meta.Version != before.Meta.Version {
+				t.Errorf("got version %s after a rejected patch, want %s", after.Meta.Version, before.Meta.Version)
+			}
+		})
+	}
+}
+
+func TestExtensionMutability(t *testing.T) {
+	const enterprise = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	extension := schema.Schema{
+		ID:   enterprise,
+		Name: optional.NewString("EnterpriseUser"),
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{Name: "department"})),
+			schema.ComplexCoreAttribute(schema.ComplexParams{
+				Name: "manager",
+				SubAttributes: []schema.SimpleParams{
+					schema.SimpleStringParams(schema.StringParams{Name: "value"}),
+					schema.SimpleStringParams(schema.StringParams{
+						Mutability: schema.AttributeMutabilityReadOnly(),
+						Name:       "displayName",
+					}),
+				},
+			}),
+		},
+	}
+	h := NewSchemaResourceHandler(testLogger(), "User", NewMemoryStore(), testUserSchema(), 100, WithSchemaExtensions(extension))
+	err := h.Restore([]scim.Resource{{ID: "1", Attributes: scim.ResourceAttributes{
+		"userName": "bjensen",
+		enterprise: map[string]interface{}{
+			"department": "Tour Operations",
+			"manager":    map[string]interface{}{"value": "26118915", "displayName": "John Smith"},
+		},
+	}}})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	r := testRequest()
+
+	_, err = h.Patch(r, "1", []scim.PatchOperation{{Op: scim.PatchOperationReplace, Value: map[string]interface{}{
+		enterprise: map[string]interface{}{"manager": map[string]interface{}{"value": "26118915", "displayName": "Jane Doe"}},
+	}}})
+	if scimErr, ok := err.(errors.ScimError); !ok || scimErr.ScimType != errors.ScimTypeMutability {
+		t.Errorf("Patch: got error %v, want a mutability error", err)
+	}
+	_, err = h.Replace(r, "1", scim.ResourceAttributes{
+		"userName": "bjensen",
+		enterprise: map[string]interface{}{"manager": map[string]interface{}{"value": "26118915", "displayName": "Jane Doe"}},
+	})
+	if scimErr, ok := err.(errors.ScimError); !ok || scimErr.ScimType != errors.ScimTypeMutability {
+		t.Errorf("Replace: got error %v, want a mutability error", err)
+	}
+
+	// a replace leaving the readOnly attribute out keeps it
+	if _, err := h.Replace(r, "1", scim.ResourceAttributes{
+		"userName": "bjensen",
+		enterprise: map[string]interface{}{"department": "Sales", "manager": map[string]interface{}{"value": "26118915"}},
+	}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	ext, _ := mustGet(t, h, "1").Attributes[enterprise].(map[string]interface{})
+	manager, _ := ext["manager"].(map[string]interface{})
+	if ext["department"] != "Sales" || manager["displayName"] != "John Smith" {
+		t.Errorf("got extension %v, want the department replaced and the manager's displayName kept", ext)
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/elimity-com/scim/schema"
+)
+
+// Option configures a resource handler.
+type Option func(*options)
+
+type options struct {
+	// upsertOnPut makes Replace create a resource that does not exist instead of returning 404
+	upsertOnPut bool
+	// idempotentDelete makes Delete of a resource that does not exist succeed instead of returning 404
+	idempotentDelete bool
+	// defaultActive makes new users active unless the request sets active
+	defaultActive bool
+	// clock tells the time of meta.created and meta.lastModified
+	clock Clock
+	// idGenerator generates the ids of new resources
+	idGenerator IDGenerator
+	// auditLog records the changes to resources if set
+	auditLog AuditLog
+	// weakETags makes meta.version and the ETag header weak entity tags
+	weakETags bool
+	// maxPatchOperations is the maximum number of operations of a patch request, unlimited if 0
+	maxPatchOperations int
+	// schemaExtensions are the schema extensions of the resource type, the mutability of their attributes is enforced
+	// like that of the attributes of the schema
+	schemaExtensions []schema.Schema
+}
+
+// WithUpsertOnPut makes Replace create the resource with the given id if it does not exist, as some IdPs expect.
+func WithUpsertOnPut() Option {
+	return func(o *options) {
+		o.upsertOnPut = true
+	}
+}
+
+// WithIdempotentDelete makes Delete succeed with 204 if the resource does not exist, e.g. was deleted by a retry.
+func WithIdempotentDelete() Option {
+	return func(o *options) {
+		o.idempotentDelete = true
+	}
+}
+
+// WithDefaultActive makes users created without the active attribute active, many IdPs omit it expecting this.
+func WithDefaultActive() Option {
+	return func(o *options) {
+		o.defaultActive = true
+	}
+}
+
+// WithClock makes the handler take the time of meta.created and meta.lastModified from c instead of the system clock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithIDGenerator makes the handler generate the ids of new resources with g instead of as random UUIDs.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(o *options) {
+		o.idGenerator = g
+	}
+}
+
+// WithAuditLog records every create, replace, patch and delete in l.
+func WithAuditLog(l AuditLog) Option {
+	return func(o *options) {
+		o.auditLog = l
+	}
+}
+
+// WithWeakETags makes the handler report versions as weak entity tags, e.g. `W/"1"`, instead of strong ones, e.g.
+// `"1"`, for clients behind proxies that weaken strong tags.
+func WithWeakETags() Option {
+	return func(o *options) {
+		o.weakETags = true
+	}
+}
+
+// WithMaxPatchOperations rejects patch requests with more than n operations with 400, each operation is applied and
+// validated in turn.
+func WithMaxPatchOperations(n int) Option {
+	return func(o *options) {
+		o.maxPatchOperations = n
+	}
+}
+
+// WithSchemaExtensions declares the schema extensions of the resource type, e.g. the enterprise User extension, so
+// their readOnly and immutable attributes can't be modified by a replace or patch either.
+func WithSchemaExtensions(extensions ...schema.Schema) Option {
+	return func(o *options) {
+		o.schemaExtensions = extensions
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: realClock{}, idGenerator: uuidGenerator{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// now returns the current time of the clock as stored in meta, i.e. in UTC truncated to seconds, so the returned times
+// match what Get reads back.
+func (o options) now() time.Time {
+	return o.clock.Now().UTC().Truncate(time.Second)
+}
+
+// etag returns the stored version of a resource as reported in meta.version and the ETag header.
+func (o options) etag(version string) string {
+	return formatETag(version, o.weakETags)
+}
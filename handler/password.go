@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/schema"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordAttribute is the writeOnly password of a user, it is stored as a bcrypt hash and never returned.
+const passwordAttribute = "password"
+
+// hashPassword replaces the cleartext password in attributes with its hash. A password that equals the one of previous
+// is already hashed, previous is nil for new resources.
+func hashPassword(previous, attributes scim.ResourceAttributes) error {
+	k, ok := attributeKey(attributes, passwordAttribute)
+	if !ok {
+		return nil
+	}
+	password, ok := attributes[k].(string)
+	if !ok {
+		delete(attributes, k)
+		return nil
+	}
+	if pk, ok := attributeKey(previous, passwordAttribute); ok && previous[pk] == password {
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	delete(attributes, k)
+	attributes[passwordAttribute] = string(hash)
+	return nil
+}
+
+// keepPassword copies the password hash of previous to attributes if they don't set a new password, clients can't
+// read the password to send it with a replace.
+func keepPassword(previous, attributes scim.ResourceAttributes) {
+	pk, ok := attributeKey(previous, passwordAttribute)
+	if !ok {
+		return
+	}
+	if _, ok := attributeKey(attributes, passwordAttribute); !ok {
+		attributes[passwordAttribute] = previous[pk]
+	}
+}
+
+// withoutNeverReturned returns a copy of attributes without the attributes s declares as never returned, such as the
+// password, including never returned sub-attributes of complex attributes.
+func withoutNeverReturned(s schema.Schema, attributes scim.ResourceAttributes) scim.ResourceAttributes {
+	return withoutNever(s.Attributes, attributes)
+}
+
+// withoutNever returns a copy of m without the attributes of attrs that are never returned.
+func withoutNever(attrs schema.Attributes, m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		attr, ok := attrs.ContainsAttribute(k)
+		if ok && attr.Returned() == "never" {
+			continue
+		}
+		if ok && attr.HasSubAttributes() {
+			v = withoutNeverSubAttributes(attr.SubAttributes(), v)
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// withoutNeverSubAttributes drops the never returned sub-attributes of a complex value, or of each element of a
+// multi-valued complex attribute.
+func withoutNeverSubAttributes(attrs schema.Attributes, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return withoutNever(attrs, v)
+	case []interface{}:
+		elements := make([]interface{}, len(v))
+		for i, e := range v {
+			elements[i] = withoutNeverSubAttributes(attrs, e)
+		}
+		return elements
+	}
+	return v
+}
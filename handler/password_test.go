@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordNeverReturned(t *testing.T) {
+	const password = "t1meMa$heen"
+	store := NewMemoryStore()
+	users := NewSchemaResourceHandler(testLogger(), "User", store, testUserSchema(), 100)
+	server := newTestServer(t, users, newTestGroupHandler())
+
+	w := serve(server, http.MethodPost, "/Users", `{"userName": "bjensen", "password": "`+password+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	id := decodeBody(t, w)["id"].(string)
+
+	responses := map[string]string{"POST": w.Body.String()}
+	responses["GET"] = serve(server, http.MethodGet, "/Users/"+id, "").Body.String()
+	responses["GET password"] = serve(server, http.MethodGet, "/Users/"+id+"?attributes=password", "").Body.String()
+	responses["list"] = serve(server, http.MethodGet, "/Users", "").Body.String()
+	responses["PATCH"] = serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`)).Body.String()
+	responses["PUT"] = serve(server, http.MethodPut, "/Users/"+id, `{"userName": "bjensen", "nickName": "Barbara"}`).Body.String()
+	for name, body := range responses {
+		if strings.Contains(strings.ToLower(body), "password") || strings.Contains(body, password) {
+			t.Errorf("%s: got the password in %s", name, body)
+		}
+	}
+	if got := listUserNames(t, server, `password pr`); len(got) != 0 {
+		t.Errorf("filter by password: got %v, want no users", got)
+	}
+
+	// the password is stored as hash and kept by the replace without one
+	record, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	hash, _ := record.Attributes["password"].(string)
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		t.Errorf("got stored password %q, want the hash of the password: %v", hash, err)
+	}
+}
@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	"github.com/elimity-com/scim/schema"
+	scimfilter "github.com/scim2/filter-parser/v2"
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// normalizeOperations rewrites the attribute names used by ops to the names declared in s. Attribute names are
+// case-insensitive, but resources are stored with the declared names, e.g. a `USERNAME` path updates `userName`.
+func normalizeOperations(s schema.Schema, ops []scim.PatchOperation) []scim.PatchOperation {
+	normalized := make([]scim.PatchOperation, len(ops))
+	for i, op := range ops {
+		if op.Path != nil {
+			path := *op.Path
+			if path.AttributePath.URIPrefix == nil || strings.EqualFold(*path.AttributePath.URIPrefix, s.ID) {
+				attr, ok := s.Attributes.ContainsAttribute(path.AttributePath.AttributeName)
+				if ok {
+					path.AttributePath.AttributeName = attr.Name()
+					path.AttributePath.SubAttribute = subAttributeName(attr, path.AttributePath.SubAttribute)
+					path.SubAttribute = subAttributeName(attr, path.SubAttribute)
+				}
+			}
+			op.Path = &path
+		} else if valueMap, ok := op.Value.(map[string]interface{}); ok {
+			values := make(map[string]interface{}, len(valueMap))
+			for k, v := range valueMap {
+				if attr, ok := s.Attributes.ContainsAttribute(k); ok {
+					k = attr.Name()
+				}
+				values[k] = v
+			}
+			op.Value = values
+		}
+		normalized[i] = op
+	}
+	return normalized
+}
+
+// subAttributeName returns the declared name of the named sub-attribute of attr, or name if it is not declared.
+func subAttributeName(attr schema.CoreAttribute, name *string) *string {
+	if name == nil {
+		return nil
+	}
+	sub, ok := attr.SubAttributes().ContainsAttribute(*name)
+	if !ok {
+		return name
+	}
+	declared := sub.Name()
+	return &declared
+}
+
+// valueFilter returns the value filter of the operation path, e.g. `type eq "work"` for `emails[type eq "work"]`,
+// or nil if the path has none. The sub-attributes are compared as their caseExact characteristic in s requires.
+func valueFilter(s schema.Schema, op scim.PatchOperation) (filter.Expression, error) {
+	if op.Path == nil || op.Path.ValueExpression == nil {
+		return nil, nil
+	}
+
+	expr, ok := convertExpression(op.Path.ValueExpression)
+	if !ok {
+		return nil, errors.ScimErrorInvalidPath
+	}
+	if attr, ok := lookupAttribute(s.ID, s.Attributes, op.Path.AttributePath.String()); ok {
+		applyCaseExact("", attr.SubAttributes(), expr)
+	}
+	return expr, nil
+}
+
+// convertExpression converts a filter as parsed by the library to the equivalent filter.Expression, ok is false if
+// it holds a node or value that has none.
+func convertExpression(expr scimfilter.Expression) (filter.Expression, bool) {
+	switch e := expr.(type) {
+	case *scimfilter.LogicalExpression:
+		left, leftOk := convertExpression(e.Left)
+		right, rightOk := convertExpression(e.Right)
+		operator := filter.LogicalOperator(strings.ToLower(string(e.Operator)))
+		if !leftOk || !rightOk || (operator != filter.And && operator != filter.Or) {
+			return nil, false
+		}
+		return &filter.LogicalExpression{Operator: operator, Left: left, Right: right}, true
+	case *scimfilter.NotExpression:
+		inner, ok := convertExpression(e.Expression)
+		if !ok {
+			return nil, false
+		}
+		return &filter.NotExpression{Expression: inner}, true
+	case *scimfilter.ValuePath:
+		inner, ok := convertExpression(e.ValueFilter)
+		if !ok {
+			return nil, false
+		}
+		return &filter.ValuePathExpression{AttributePath: e.AttributePath.String(), Filter: inner}, true
+	case *scimfilter.AttributeExpression:
+		value, ok := convertValue(e.CompareValue)
+		if !ok {
+			return nil, false
+		}
+		return &filter.AttributeExpression{
+			AttributePath: e.AttributePath.String(),
+			Operator:      filter.Operator(strings.ToLower(string(e.Operator))),
+			Value:         value,
+		}, true
+	}
+	return nil, false
+}
+
+// convertValue converts a comparison value as parsed by the library to the value of a filter.AttributeExpression,
+// i.e. numbers become a json.Number and escape sequences of strings are decoded.
+func convertValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil, bool, json.Number:
+		return v, true
+	case string:
+		// the quotes are trimmed but escape sequences are kept, e.g. `\"`
+		if unquoted, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			return unquoted, true
+		}
+		return v, true
+	case int:
+		return json.Number(strconv.Itoa(v)), true
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), true
+	}
+	return nil, false
+}
+
+// matchingValues returns the indexes of the elements of a multi-valued attribute that match expr.
+func matchingValues(attributes scim.ResourceAttributes, name string, expr filter.Expression) []int {
+	values, _ := attributes[name].([]interface{})
+
+	var indexes []int
+	for i, v := range values {
+		if element, ok := v.(map[string]interface{}); ok && expr.Matches(element) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// removeMatching removes the elements of the multi-valued attribute targeted by op that match expr. If the path
+// addresses a sub-attribute, e.g. `emails[type eq "work"].display`, only that sub-attribute is removed.
+func removeMatching(attributes scim.ResourceAttributes, op scim.PatchOperation, expr filter.Expression) {
+	name := op.Path.AttributePath.String()
+	indexes := matchingValues(attributes, name, expr)
+	if len(indexes) == 0 {
+		return
+	}
+
+	values := attributes[name].([]interface{})
+	kept := make([]interface{}, 0, len(values))
+	for i, v := range values {
+		if len(indexes) == 0 || indexes[0] != i {
+			kept = append(kept, v)
+			continue
+		}
+		indexes = indexes[1:]
+
+		if op.Path.SubAttribute != nil {
+			element := v.(map[string]interface{})
+			delete(element, *op.Path.SubAttribute)
+			kept = append(kept, element)
+		}
+	}
+
+	if len(kept) == 0 {
+		attributes[name] = nil
+		return
+	}
+	attributes[name] = kept
+}
+
+// updateMatching applies an add or replace operation to the elements of the multi-valued attribute targeted by op that
+// match expr. The path either addresses a sub-attribute, e.g. `emails[type eq "work"].value`, or the value holds the
+// sub-attributes to set on the matching elements. Returns a noTarget error if no element matches.
+func updateMatching(attributes scim.ResourceAttributes, op scim.PatchOperation, expr filter.Expression) error {
+	name := op.Path.AttributePath.String()
+	indexes := matchingValues(attributes, name, expr)
+	if len(indexes) == 0 {
+		return errors.ScimErrorNoTarget
+	}
+
+	// the library wraps the value of a multi-valued attribute path in a slice
+	value := op.Value
+	if values, ok := value.([]interface{}); ok && op.Path.SubAttribute == nil && len(values) == 1 {
+		value = values[0]
+	}
+
+	values := attributes[name].([]interface{})
+	for _, i := range indexes {
+		element := values[i].(map[string]interface{})
+		if op.Path.SubAttribute != nil {
+			element[*op.Path.SubAttribute] = value
+			continue
+		}
+
+		subAttributes, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.ScimErrorInvalidValue
+		}
+		for k, v := range subAttributes {
+			element[k] = v
+		}
+	}
+	return nil
+}
+
+// pathKeys returns the keys of the nested attribute addressed by the path of op, which has no value filter, e.g. `name`
+// and `givenName` for `name.givenName`. Attributes of a schema extension other than s are nested under its URN.
+func pathKeys(s schema.Schema, op scim.PatchOperation) []string {
+	var keys []string
+	if uri := op.Path.AttributePath.URI(); uri != "" && !strings.EqualFold(uri, s.ID) {
+		keys = append(keys, uri)
+	}
+	keys = append(keys, op.Path.AttributePath.AttributeName)
+	if op.Path.AttributePath.SubAttribute != nil {
+		keys = append(keys, *op.Path.AttributePath.SubAttribute)
+	}
+	return keys
+}
+
+// getPath returns the value of the nested attribute addressed by keys.
+func getPath(attributes scim.ResourceAttributes, keys []string) interface{} {
+	var current interface{} = map[string]interface{}(attributes)
+	for _, key := range keys {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		k, ok := attributeKey(m, key)
+		if !ok {
+			return nil
+		}
+		current = m[k]
+	}
+	return current
+}
+
+// setPath sets the nested attribute addressed by keys to value, creating intermediate complex attributes as needed.
+// Returns an invalidPath error if a parent is not a complex attribute.
+func setPath(attributes scim.ResourceAttributes, keys []string, value interface{}) error {
+	m := map[string]interface{}(attributes)
+	for _, key := range keys[:len(keys)-1] {
+		k, ok := attributeKey(m, key)
+		if !ok || m[k] == nil {
+			k = key
+			m[k] = make(map[string]interface{})
+		}
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			return errors.ScimErrorInvalidPath
+		}
+		m = child
+	}
+
+	last := keys[len(keys)-1]
+	if k, ok := attributeKey(m, last); ok {
+		last = k
+	}
+	m[last] = value
+	return nil
+}
+
+// removePath removes the nested attribute addressed by keys.
+func removePath(attributes scim.ResourceAttributes, keys []string) {
+	parent := map[string]interface{}(attributes)
+	if len(keys) > 1 {
+		var ok bool
+		if parent, ok = getPath(attributes, keys[:len(keys)-1]).(map[string]interface{}); !ok {
+			return
+		}
+	}
+	if k, ok := attributeKey(parent, keys[len(keys)-1]); ok {
+		delete(parent, k)
+	}
+}
+
+// appendValue adds value to a multi-valued attribute such as members, any other attribute is overwritten. Values that
+// are already present, e.g. a member with the same "value", are not added again.
+func appendValue(current, value interface{}) interface{} {
+	arr, ok := current.([]interface{})
+	if !ok {
+		return value
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if indexOfValue(arr, v) < 0 {
+			arr = append(arr, v)
+		}
+	}
+	return arr
+}
+
+// removeValues removes the given values from a multi-valued attribute, a complex value is removed if an element has the
+// same "value" sub-attribute. Returns nil if no values are left.
+func removeValues(current, value interface{}) interface{} {
+	arr, ok := current.([]interface{})
+	if !ok {
+		return current
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	kept := make([]interface{}, 0, len(arr))
+	for _, v := range arr {
+		if indexOfValue(values, v) < 0 {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// indexOfValue returns the index of value in values or -1. Complex values are compared by their "value" sub-attribute
+// if they have one.
+func indexOfValue(values []interface{}, value interface{}) int {
+	for i, v := range values {
+		if reflect.DeepEqual(identity(v), identity(value)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// identity returns the "value" sub-attribute of a complex value, or the value itself.
+func identity(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		if value, ok := m["value"]; ok {
+			return value
+		}
+	}
+	return v
+}
+
+// noContentOperation reports whether op leaves data unchanged: replacing or adding a value identical to the stored
+// one, or removing an attribute that is already absent. Removing an existing attribute is always a change.
+func noContentOperation(s schema.Schema, data Record, op scim.PatchOperation) bool {
+	if op.Path == nil {
+		valueMap, ok := op.Value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range valueMap {
+			if !reflect.DeepEqual(data.Attributes[k], v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	attrValue := getPath(data.Attributes, pathKeys(s, op))
+	if strings.EqualFold(op.Op, scim.PatchOperationRemove) {
+		// removing elements that match no value filter leaves the resource as is
+		if op.Path.ValueExpression != nil {
+			expr, err := valueFilter(s, op)
+			if err != nil {
+				return false
+			}
+			return len(matchingValues(data.Attributes, op.Path.AttributePath.String(), expr)) == 0
+		}
+		return attrValue == nil
+	}
+	return attrValue != nil && reflect.DeepEqual(attrValue, op.Value)
+}
+
+func shouldReturnNoContent(s schema.Schema, data Record, ops []scim.PatchOperation) bool {
+	for _, op := range ops {
+		if noContentOperation(s, data, op) {
+			continue
+		}
+		return false
+	}
+	return true
+}
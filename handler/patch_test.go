@@ -0,0 +1,405 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	scimfilter "github.com/scim2/filter-parser/v2"
+)
+
+// patchBody returns the body of a PATCH request with the given JSON array of operations.
+func patchBody(operations string) string {
+	return `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": ` + operations + `}`
+}
+
+func TestPatchRemoveNoContent(t *testing.T) {
+	const user = `{
+		"userName": "bjensen",
+		"nickName": "Babs",
+		"name": {"givenName": "Barbara"},
+		"emails": [{"value": "bjensen@example.com", "type": "work"}]
+	}`
+
+	tests := []struct {
+		name, operations string
+		want             int
+	}{
+		{"absent attribute", `[{"op": "remove", "path": "externalId"}]`, http.StatusNoContent},
+		{"present attribute", `[{"op": "remove", "path": "nickName"}]`, http.StatusOK},
+		{"absent sub-attribute", `[{"op": "remove", "path": "name.familyName"}]`, http.StatusNoContent},
+		{"present sub-attribute", `[{"op": "remove", "path": "name.givenName"}]`, http.StatusOK},
+		{"filter matching nothing", `[{"op": "remove", "path": "emails[type eq \"home\"]"}]`, http.StatusNoContent},
+		{"filter matching a value", `[{"op": "remove", "path": "emails[type eq \"work\"]"}]`, http.StatusOK},
+		{"absent and present attributes", `[{"op": "remove", "path": "externalId"}, {"op": "remove", "path": "nickName"}]`, http.StatusOK},
+		{"present and absent attributes", `[{"op": "remove", "path": "nickName"}, {"op": "remove", "path": "externalId"}]`, http.StatusOK},
+		{"identical replace", `[{"op": "replace", "path": "nickName", "value": "Babs"}]`, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+			id := mustCreate(t, server, "/Users", user)
+
+			w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(test.operations))
+			if w.Code != test.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, test.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchRemoveEmailByType(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{
+		"userName": "bjensen",
+		"emails": [
+			{"value": "bjensen@example.com", "type": "work"},
+			{"value": "babs@jensen.org", "type": "home"}
+		]
+	}`)
+
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "remove", "path": "emails[type eq \"work\"]"}]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	emails, _ := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))["emails"].([]interface{})
+	if len(emails) != 1 {
+		t.Fatalf("got emails %v, want only the home email", emails)
+	}
+	if email := emails[0].(map[string]interface{}); email["type"] != "home" || email["value"] != "babs@jensen.org" {
+		t.Errorf("got email %v, want the home email", email)
+	}
+}
+
+func TestConvertExpression(t *testing.T) {
+	tests := []struct {
+		filter     string
+		attributes map[string]interface{}
+		want       bool
+	}{
+		{`type eq "work"`, map[string]interface{}{"type": "work"}, true},
+		{`type eq "work"`, map[string]interface{}{"type": "home"}, false},
+		{`value eq "say \"hi\"@example.com"`, map[string]interface{}{"value": `say "hi"@example.com`}, true},
+		{`value eq "back\\slash"`, map[string]interface{}{"value": `back\slash`}, true},
+		{`type eq "work" and primary eq true`, map[string]interface{}{"type": "work", "primary": true}, true},
+		{`type eq "work" or type eq "home"`, map[string]interface{}{"type": "home"}, true},
+		{`not (type eq "work")`, map[string]interface{}{"type": "home"}, true},
+		{`value co "example.com"`, map[string]interface{}{"value": "bjensen@example.com"}, true},
+		{`display pr`, map[string]interface{}{}, false},
+		{`rank gt 1`, map[string]interface{}{"rank": json.Number("2")}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			parsed, err := scimfilter.ParseFilter([]byte(test.filter))
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			expr, ok := convertExpression(parsed)
+			if !ok {
+				t.Fatal("convertExpression: got not ok")
+			}
+			if got := expr.Matches(test.attributes); got != test.want {
+				t.Errorf("Matches(%v): got %v, want %v", test.attributes, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPatchWorkEmailByValuePath(t *testing.T) {
+	const user = `{
+		"userName": "bjensen",
+		"emails": [
+			{"value": "bjensen@example.com", "type": "work"},
+			{"value": "babs@jensen.org", "type": "home"}
+		]
+	}`
+
+	for _, op := range []string{"replace", "add"} {
+		t.Run(op, func(t *testing.T) {
+			server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+			id := mustCreate(t, server, "/Users", user)
+
+			w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "`+op+`", "path": "emails[type eq \"work\"].value", "value": "barbara@example.com"}]`))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			emails, _ := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))["emails"].([]interface{})
+			values := make(map[string]interface{})
+			for _, e := range emails {
+				email := e.(map[string]interface{})
+				values[email["type"].(string)] = email["value"]
+			}
+			if len(emails) != 2 || values["work"] != "barbara@example.com" || values["home"] != "babs@jensen.org" {
+				t.Errorf("got emails %v, want the work email changed only", emails)
+			}
+		})
+	}
+}
+
+func TestPatchVersions(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.Meta.Version != `"1"` {
+		t.Errorf("Create: got version %s, want \"1\"", created.Meta.Version)
+	}
+
+	for i, nickName := range []string{"Babs", "Barb", "Barbara"} {
+		patched, err := h.Patch(r, created.ID, []scim.PatchOperation{
+			{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": nickName}},
+		})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+		if want := fmt.Sprintf(`"%d"`, i+2); patched.Meta.Version != want {
+			t.Errorf("Patch %d: got version %s, want %s", i+1, patched.Meta.Version, want)
+		}
+	}
+	if got := mustGet(t, h, created.ID).Meta.Version; got != `"4"` {
+		t.Errorf("Get: got version %s, want \"4\"", got)
+	}
+}
+
+func TestPatchNotFound(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	w := serve(server, http.MethodPatch, "/Users/missing", patchBody(`[{"op": "replace", "path": "nickName", "value": "Babs"}]`))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusNotFound, w.Body.String())
+	}
+	body := decodeBody(t, w)
+	if body["status"] != "404" {
+		t.Errorf("got SCIM error status %v, want 404", body["status"])
+	}
+	if schemas, _ := body["schemas"].([]interface{}); len(schemas) != 1 || schemas[0] != "urn:ietf:params:scim:api:messages:2.0:Error" {
+		t.Errorf("got schemas %v, want the SCIM error schema", body["schemas"])
+	}
+}
+
+func TestPatchUnexpectedValueTypes(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for _, op := range []string{scim.PatchOperationReplace, scim.PatchOperationAdd} {
+		for _, value := range []interface{}{"Babs", []interface{}{"Babs", "Barbara"}} {
+			_, err := h.Patch(r, created.ID, []scim.PatchOperation{{Op: op, Value: value}})
+			scimErr, ok := err.(errors.ScimError)
+			if !ok || scimErr.Status != http.StatusBadRequest {
+				t.Errorf("%s of %#v: got error %v, want a 400 SCIM error", op, value, err)
+			}
+		}
+	}
+
+	server := newTestServer(t, h, newTestGroupHandler())
+	for _, value := range []string{`"Babs"`, `["Babs", "Barbara"]`} {
+		w := serve(server, http.MethodPatch, "/Users/"+created.ID, patchBody(`[{"op": "replace", "value": `+value+`}]`))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("replace of %s: got status %d, want %d: %s", value, w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	}
+}
+
+func TestPatchMixedCasePaths(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen", "name": {"givenName": "Barbara"}}`)
+
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[
+		{"op": "replace", "path": "USERNAME", "value": "babs"},
+		{"op": "replace", "path": "Name.GIVENNAME", "value": "Babs"}
+	]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	body := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))
+	if body["userName"] != "babs" {
+		t.Errorf("got userName %v, want babs", body["userName"])
+	}
+	if name, _ := body["name"].(map[string]interface{}); len(name) != 1 || name["givenName"] != "Babs" {
+		t.Errorf("got name %v, want the givenName replaced", body["name"])
+	}
+	for _, k := range []string{"USERNAME", "Name"} {
+		if _, ok := body[k]; ok {
+			t.Errorf("got attribute %s, want the declared name", k)
+		}
+	}
+}
+
+func TestPatchNestedSubAttribute(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server := newTestServer(t, h, newTestGroupHandler())
+
+	steps := []struct {
+		operations string
+		want       map[string]interface{}
+	}{
+		{`[{"op": "add", "path": "name.givenName", "value": "Barbara"}]`, map[string]interface{}{"givenName": "Barbara"}},
+		{`[{"op": "add", "path": "name.familyName", "value": "Jensen"}]`, map[string]interface{}{"givenName": "Barbara", "familyName": "Jensen"}},
+		{`[{"op": "replace", "path": "name.givenName", "value": "Babs"}]`, map[string]interface{}{"givenName": "Babs", "familyName": "Jensen"}},
+	}
+	for _, step := range steps {
+		w := serve(server, http.MethodPatch, "/Users/"+created.ID, patchBody(step.operations))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d: %s", step.operations, w.Code, http.StatusOK, w.Body.String())
+		}
+		if got := mustGet(t, h, created.ID).Attributes["name"]; !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got name %v, want %v", step.operations, got, step.want)
+		}
+	}
+	if _, ok := mustGet(t, h, created.ID).Attributes["name.givenName"]; ok {
+		t.Error("got a name.givenName attribute, want a nested name")
+	}
+}
+
+// mustParsePath parses the attribute path of a patch operation.
+func mustParsePath(t *testing.T, path string) *scimfilter.Path {
+	t.Helper()
+
+	parsed, err := scimfilter.ParsePath([]byte(path))
+	if err != nil {
+		t.Fatalf("failed to parse path %q: %v", path, err)
+	}
+	return &parsed
+}
+
+func TestPatchIdenticalValue(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	h := newTestUserHandler(WithClock(clock))
+	r := testRequest()
+	created, err := h.Create(r, scim.ResourceAttributes{
+		"userName": "bjensen",
+		"nickName": "Babs",
+		"emails":   []interface{}{map[string]interface{}{"value": "bjensen@example.com", "type": "work"}},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	for _, operation := range []scim.PatchOperation{
+		{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": "Babs"}},
+		{Op: scim.PatchOperationAdd, Value: map[string]interface{}{"userName": "bjensen"}},
+		{Op: scim.PatchOperationRemove, Path: mustParsePath(t, "title")},
+	} {
+		if _, err := h.Patch(r, created.ID, []scim.PatchOperation{operation}); err != nil {
+			t.Fatalf("Patch %s: %v", operation.Op, err)
+		}
+		// a remove responds without the resource
+		got := mustGet(t, h, created.ID)
+		if !got.Meta.LastModified.Equal(start) || got.Meta.Version != created.Meta.Version {
+			t.Errorf("Patch %s: got lastModified %v and version %s, want %v and %s", operation.Op, got.Meta.LastModified, got.Meta.Version, start, created.Meta.Version)
+		}
+	}
+
+	// a real change moves lastModified
+	patched, err := h.Patch(r, created.ID, []scim.PatchOperation{
+		{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": "Barbara"}},
+	})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if want := start.Add(time.Hour); !patched.Meta.LastModified.Equal(want) {
+		t.Errorf("Patch: got lastModified %v, want %v", patched.Meta.LastModified, want)
+	}
+}
+
+func TestPatchGroupMembers(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	bjensen := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	jsmith := mustCreate(t, server, "/Users", `{"userName": "jsmith"}`)
+	id := mustCreate(t, server, "/Groups", `{"displayName": "Tour Guides"}`)
+
+	members := func() []interface{} {
+		t.Helper()
+		var values []interface{}
+		group := decodeBody(t, serve(server, http.MethodGet, "/Groups/"+id, ""))
+		members, _ := group["members"].([]interface{})
+		for _, member := range members {
+			values = append(values, member.(map[string]interface{})["value"])
+		}
+		return values
+	}
+
+	w := serve(server, http.MethodPatch, "/Groups/"+id, patchBody(fmt.Sprintf(`[
+		{"op": "add", "path": "members", "value": [{"value": %q, "display": "Babs Jensen"}, {"value": %q}]}
+	]`, bjensen, jsmith)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("add: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := members(), []interface{}{bjensen, jsmith}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after add: got members %v, want %v", got, want)
+	}
+
+	w = serve(server, http.MethodPatch, "/Groups/"+id, patchBody(fmt.Sprintf(`[
+		{"op": "remove", "path": "members[value eq \"%s\"]"}
+	]`, bjensen)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := members(), []interface{}{jsmith}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after remove: got members %v, want %v", got, want)
+	}
+}
+
+func TestMaxPatchOperations(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(WithMaxPatchOperations(2)), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+
+	operation := `{"op": "replace", "path": "nickName", "value": "Babs"}`
+	if w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[`+operation+`, `+operation+`]`)); w.Code != http.StatusOK {
+		t.Fatalf("2 operations: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[
+		{"op": "replace", "path": "nickName", "value": "B"},
+		{"op": "replace", "path": "name.givenName", "value": "Barbara"},
+		{"op": "replace", "path": "active", "value": false}
+	]`))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("3 operations: got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if detail, _ := decodeBody(t, w)["detail"].(string); detail != "The request has 3 operations, the maximum is 2." {
+		t.Errorf("got detail %q", detail)
+	}
+	// none of the operations were applied
+	if user := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, "")); user["nickName"] != "Babs" || user["name"] != nil {
+		t.Errorf("got user %v, want it unchanged", user)
+	}
+}
+
+func TestPatchNoOperations(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	version := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))["meta"].(map[string]interface{})["version"]
+
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[]`))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if body := decodeBody(t, w); body["status"] != "400" {
+		t.Errorf("got SCIM error status %v, want 400", body["status"])
+	}
+	if meta := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))["meta"].(map[string]interface{}); meta["version"] != version {
+		t.Errorf("got version %v, want %v", meta["version"], version)
+	}
+}
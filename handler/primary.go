@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/elimity-com/scim"
+)
+
+// normalizePrimary makes sure at most one element of each multi-valued attribute, e.g. emails, is primary, see RFC 7643
+// section 2.4. If several are, the element that was newly marked primary compared to previous stays primary, falling
+// back to the last one. previous is nil for new resources.
+func normalizePrimary(previous, attributes scim.ResourceAttributes) {
+	for k, v := range attributes {
+		values, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+
+		var primaries []int
+		for i, e := range values {
+			if element, ok := e.(map[string]interface{}); ok && isPrimary(element) {
+				primaries = append(primaries, i)
+			}
+		}
+		if len(primaries) < 2 {
+			continue
+		}
+
+		previousValue, hadPrimary := primaryValue(previous[k])
+		keep := primaries[len(primaries)-1]
+		for j := len(primaries) - 1; j >= 0; j-- {
+			element := values[primaries[j]].(map[string]interface{})
+			if !hadPrimary || !reflect.DeepEqual(element["value"], previousValue) {
+				keep = primaries[j]
+				break
+			}
+		}
+		for _, i := range primaries {
+			if i != keep {
+				values[i].(map[string]interface{})["primary"] = false
+			}
+		}
+	}
+}
+
+// isPrimary reports whether the element of a multi-valued attribute is primary. Some clients send booleans as strings.
+func isPrimary(element map[string]interface{}) bool {
+	switch primary := element["primary"].(type) {
+	case bool:
+		return primary
+	case string:
+		b, _ := strconv.ParseBool(primary)
+		return b
+	}
+	return false
+}
+
+// primaryValue returns the value of the primary element of a multi-valued attribute.
+func primaryValue(v interface{}) (interface{}, bool) {
+	values, _ := v.([]interface{})
+	for _, e := range values {
+		if element, ok := e.(map[string]interface{}); ok && isPrimary(element) {
+			return element["value"], true
+		}
+	}
+	return nil, false
+}
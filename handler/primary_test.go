@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// primaryEmails returns the values of the primary emails of a user.
+func primaryEmails(t *testing.T, user map[string]interface{}) []interface{} {
+	t.Helper()
+
+	emails, _ := user["emails"].([]interface{})
+	var primaries []interface{}
+	for _, e := range emails {
+		email := e.(map[string]interface{})
+		if isPrimary(email) {
+			primaries = append(primaries, email["value"])
+		}
+	}
+	return primaries
+}
+
+func TestPrimaryEmails(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	w := serve(server, http.MethodPost, "/Users", `{"userName": "bjensen", "emails": [
+		{"value": "bjensen@example.com", "type": "work", "primary": true},
+		{"value": "babs@jensen.org", "type": "home", "primary": true}
+	]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	created := decodeBody(t, w)
+	if got, want := primaryEmails(t, created), []interface{}{"babs@jensen.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("POST: got primary emails %v, want %v", got, want)
+	}
+	id := created["id"].(string)
+	if got, want := primaryEmails(t, decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, ""))), []interface{}{"babs@jensen.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GET: got primary emails %v, want %v", got, want)
+	}
+
+	// an email patched to primary replaces the current primary, even if it is not the last one
+	w = serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "emails[type eq \"work\"].primary", "value": true}]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := primaryEmails(t, decodeBody(t, w)), []interface{}{"bjensen@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PATCH: got primary emails %v, want %v", got, want)
+	}
+}
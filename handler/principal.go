@@ -0,0 +1,16 @@
+package handler
+
+import "context"
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the id of the user the request is authenticated as.
+func WithPrincipal(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, principalKey{}, userID)
+}
+
+// Principal returns the id of the user stored in ctx, or an empty string if the request is not authenticated as one.
+func Principal(ctx context.Context) string {
+	id, _ := ctx.Value(principalKey{}).(string)
+	return id
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/schema"
+)
+
+// projectAttributes returns the attributes selected by the attributes and excludedAttributes query parameters of r,
+// e.g. `?attributes=userName,name.givenName` returns only the givenName of the name, following the returned
+// characteristic of the attributes of s and their sub-attributes, see RFC 7643
+// section 7: "never" attributes are never returned, "request" attributes only if listed in attributes and "always"
+// attributes regardless of the parameters. The id, schemas and meta are added by the library and always returned.
+func projectAttributes(r *http.Request, s schema.Schema, attributes scim.ResourceAttributes) scim.ResourceAttributes {
+	attributes = withoutNeverReturned(s, attributes)
+	included := attributeList(r.URL.Query().Get("attributes"))
+	excluded := attributeList(r.URL.Query().Get("excludedAttributes"))
+
+	var projected scim.ResourceAttributes
+	if len(included) > 0 {
+		var selected interface{} = map[string]interface{}{}
+		for _, path := range included {
+			selected = includePath(map[string]interface{}(attributes), selected, attributeKeys(attributes, path))
+		}
+		includeAlwaysReturned(s.Attributes, map[string]interface{}(attributes), selected.(map[string]interface{}))
+		projected = dropNil(selected).(map[string]interface{})
+	} else {
+		projected = copyAttributes(attributes)
+		for _, name := range returnedAttributes(s, "request") {
+			if k, ok := attributeKey(projected, name); ok {
+				delete(projected, k)
+			}
+		}
+	}
+	for _, path := range excluded {
+		excludePath(map[string]interface{}(projected), attributeKeys(projected, path))
+	}
+
+	for _, name := range returnedAttributes(s, "always") {
+		if k, ok := attributeKey(attributes, name); ok {
+			projected[k] = attributes[k]
+		}
+	}
+	return projected
+}
+
+// includeAlwaysReturned copies the "always" returned sub-attributes of the complex attributes selected in dst from src,
+// e.g. with `?attributes=name.givenName` and an always returned name.formatted both are returned. The elements of
+// multi-valued attributes in dst are still aligned with src, i.e. nil for the elements that weren't selected.
+func includeAlwaysReturned(attrs schema.Attributes, src, dst map[string]interface{}) {
+	for k, v := range dst {
+		attr, ok := attrs.ContainsAttribute(k)
+		if !ok || !attr.HasSubAttributes() {
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			element, _ := src[k].(map[string]interface{})
+			includeAlwaysReturnedSubAttributes(attr.SubAttributes(), element, v)
+		case []interface{}:
+			elements, _ := src[k].([]interface{})
+			for i, e := range v {
+				selected, ok := e.(map[string]interface{})
+				if !ok || i >= len(elements) {
+					continue
+				}
+				element, _ := elements[i].(map[string]interface{})
+				includeAlwaysReturnedSubAttributes(attr.SubAttributes(), element, selected)
+			}
+		}
+	}
+}
+
+// includeAlwaysReturnedSubAttributes copies the "always" returned sub-attributes of the complex value src to dst.
+func includeAlwaysReturnedSubAttributes(attrs schema.Attributes, src, dst map[string]interface{}) {
+	for _, attr := range attrs {
+		if attr.Returned() != "always" {
+			continue
+		}
+		if k, ok := attributeKey(src, attr.Name()); ok {
+			dst[k] = copyValue(src[k])
+		}
+	}
+}
+
+// returnedAttributes returns the names of the attributes of s with the given returned characteristic, e.g. "request".
+func returnedAttributes(s schema.Schema, returned string) []string {
+	var names []string
+	for _, attr := range s.Attributes {
+		if attr.Returned() == returned {
+			names = append(names, attr.Name())
+		}
+	}
+	return names
+}
+
+// attributeList splits a comma separated list of attribute paths.
+func attributeList(s string) []string {
+	var paths []string
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// attributeKeys splits an attribute path into the names of the nested attributes it addresses. A schema URN prefix
+// addresses the extension stored under that URN, the core schema URN is dropped, e.g.
+// `urn:ietf:params:scim:schemas:core:2.0:User:name.givenName` addresses `name` and `givenName`.
+func attributeKeys(attributes scim.ResourceAttributes, path string) []string {
+	if !strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return strings.Split(path, ".")
+	}
+	if _, ok := attributeKey(attributes, path); ok {
+		// the whole extension
+		return []string{path}
+	}
+
+	i := strings.LastIndex(path, ":")
+	keys := strings.Split(path[i+1:], ".")
+	if _, ok := attributeKey(attributes, path[:i]); ok {
+		return append([]string{path[:i]}, keys...)
+	}
+	return keys
+}
+
+// attributeKey returns the key of the named attribute in m, attribute names are case-insensitive.
+func attributeKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// includePath copies the value addressed by keys from src to dst and returns dst. The sub-attributes of multi-valued
+// attributes are copied for every element, leaving nil for elements without the sub-attribute.
+func includePath(src, dst interface{}, keys []string) interface{} {
+	if len(keys) == 0 {
+		return copyValue(src)
+	}
+
+	switch src := src.(type) {
+	case map[string]interface{}:
+		k, ok := attributeKey(src, keys[0])
+		if !ok {
+			return dst
+		}
+		m, _ := dst.(map[string]interface{})
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		if v := includePath(src[k], m[k], keys[1:]); v != nil {
+			m[k] = v
+		}
+		return m
+	case []interface{}:
+		arr, _ := dst.([]interface{})
+		if arr == nil {
+			arr = make([]interface{}, len(src))
+		}
+		for i, e := range src {
+			arr[i] = includePath(e, arr[i], keys)
+		}
+		return arr
+	default:
+		return dst
+	}
+}
+
+// excludePath removes the value addressed by keys from the decoded JSON value v.
+func excludePath(v interface{}, keys []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		k, ok := attributeKey(v, keys[0])
+		if !ok {
+			return
+		}
+		if len(keys) == 1 {
+			delete(v, k)
+			return
+		}
+		excludePath(v[k], keys[1:])
+	case []interface{}:
+		for _, e := range v {
+			excludePath(e, keys)
+		}
+	}
+}
+
+// dropNil removes the nil elements that includePath leaves in multi-valued attributes.
+func dropNil(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = dropNil(e)
+		}
+		return v
+	case []interface{}:
+		kept := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			if e != nil {
+				kept = append(kept, dropNil(e))
+			}
+		}
+		return kept
+	default:
+		return v
+	}
+}
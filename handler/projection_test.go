@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/optional"
+	"github.com/elimity-com/scim/schema"
+)
+
+const projectedUser = `{
+	"userName": "bjensen",
+	"nickName": "Babs",
+	"name": {"givenName": "Barbara", "familyName": "Jensen"},
+	"emails": [{"value": "bjensen@example.com", "type": "work"}]
+}`
+
+func TestProjection(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	id := mustCreate(t, server, "/Users", projectedUser)
+
+	tests := []struct {
+		query       string
+		present     []string
+		absent      []string
+		namePresent []string
+		nameAbsent  []string
+	}{
+		{"attributes=userName", []string{"id", "userName"}, []string{"nickName", "name", "emails"}, nil, nil},
+		{"attributes=name.givenName", []string{"id", "name"}, []string{"userName", "nickName", "emails"}, []string{"givenName"}, []string{"familyName"}},
+		{"excludedAttributes=nickName,emails", []string{"id", "userName", "name"}, []string{"nickName", "emails"}, []string{"givenName", "familyName"}, nil},
+		{"excludedAttributes=name.familyName", []string{"id", "userName", "nickName", "name", "emails"}, nil, []string{"givenName"}, []string{"familyName"}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := serve(server, http.MethodGet, "/Users/"+id+"?"+test.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			body := decodeBody(t, w)
+			for _, k := range test.present {
+				if _, ok := body[k]; !ok {
+					t.Errorf("got no %s", k)
+				}
+			}
+			for _, k := range test.absent {
+				if _, ok := body[k]; ok {
+					t.Errorf("got %s, want it left out", k)
+				}
+			}
+			name, _ := body["name"].(map[string]interface{})
+			for _, k := range test.namePresent {
+				if _, ok := name[k]; !ok {
+					t.Errorf("got no name.%s", k)
+				}
+			}
+			for _, k := range test.nameAbsent {
+				if _, ok := name[k]; ok {
+					t.Errorf("got name.%s, want it left out", k)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectionSubAttribute(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	mustCreate(t, server, "/Users", projectedUser)
+
+	tests := []struct {
+		query, attribute string
+		want             map[string]interface{}
+	}{
+		{"attributes=emails.value", "emails", map[string]interface{}{"value": "bjensen@example.com"}},
+		{"attributes=name.givenName", "name", map[string]interface{}{"givenName": "Barbara"}},
+		{"attributes=urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", "name", map[string]interface{}{"familyName": "Jensen"}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			// listed resources are projected the same as a single one
+			w := serve(server, http.MethodGet, "/Users?"+test.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			resources, _ := decodeBody(t, w)["Resources"].([]interface{})
+			if len(resources) != 1 {
+				t.Fatalf("got resources %v, want bjensen", resources)
+			}
+			resource := resources[0].(map[string]interface{})
+			got := resource[test.attribute]
+			if values, ok := got.([]interface{}); ok && len(values) == 1 {
+				got = values[0]
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %s %v, want %v", test.attribute, got, test.want)
+			}
+			for k := range resource {
+				if k != test.attribute && k != "id" && k != "schemas" && k != "meta" {
+					t.Errorf("got %s, want only %s", k, test.attribute)
+				}
+			}
+		})
+	}
+}
+
+// returnedSchema returns a User schema with a never returned password, a request-only nickName and an always returned
+// userName.
+func returnedSchema() schema.Schema {
+	return schema.Schema{
+		ID:   schema.UserSchema,
+		Name: optional.NewString("User"),
+		Attributes: []schema.CoreAttribute{
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:     "userName",
+				Required: true,
+				Returned: schema.AttributeReturnedAlways(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Name:     "nickName",
+				Returned: schema.AttributeReturnedRequest(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{
+				Mutability: schema.AttributeMutabilityWriteOnly(),
+				Name:       "password",
+				Returned:   schema.AttributeReturnedNever(),
+			})),
+			schema.SimpleCoreAttribute(schema.SimpleStringParams(schema.StringParams{Name: "title"})),
+		},
+	}
+}
+
+func TestProjectionReturned(t *testing.T) {
+	h := NewSchemaResourceHandler(testLogger(), "User", NewMemoryStore(), returnedSchema(), 100)
+	created, err := h.Create(testRequest(), scim.ResourceAttributes{
+		"userName": "bjensen",
+		"nickName": "Babs",
+		"password": "t1meMa$heen",
+		"title":    "Tour Guide",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		query   string
+		present []string
+		absent  []string
+	}{
+		{"", []string{"userName", "title"}, []string{"nickName", "password"}},
+		{"attributes=nickName", []string{"userName", "nickName"}, []string{"title", "password"}},
+		{"attributes=password,title", []string{"userName", "title"}, []string{"nickName", "password"}},
+		{"excludedAttributes=title", []string{"userName"}, []string{"title", "nickName", "password"}},
+		{"excludedAttributes=userName", []string{"userName", "title"}, []string{"nickName", "password"}},
+	}
+	for _, test := range tests {
+		name := test.query
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/Users/"+created.ID+"?"+test.query, nil)
+			resource, err := h.Get(r, created.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			page, err := h.GetAll(r, scim.ListRequestParams{Count: 10, StartIndex: 1})
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+
+			for name, attributes := range map[string]scim.ResourceAttributes{"Get": resource.Attributes, "GetAll": page.Resources[0].Attributes} {
+				for _, k := range test.present {
+					if _, ok := attributes[k]; !ok {
+						t.Errorf("%s: got no %s", name, k)
+					}
+				}
+				for _, k := range test.absent {
+					if _, ok := attributes[k]; ok {
+						t.Errorf("%s: got %s, want it left out", name, k)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is the header used to correlate a request across logs.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestLogger returns a log entry tagged with the request ID of r, if any.
+func RequestLogger(l *logrus.Logger, r *http.Request) *logrus.Entry {
+	if r == nil {
+		return logrus.NewEntry(l)
+	}
+	if id := RequestID(r.Context()); id != "" {
+		return l.WithField("request_id", id)
+	}
+	return logrus.NewEntry(l)
+}
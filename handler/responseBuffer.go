@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Verify responseBuffer is of type http.ResponseWriter
+var _ http.ResponseWriter = &responseBuffer{}
+
+// responseBuffer is an http.ResponseWriter keeping the response in memory, so a middleware can inspect or rewrite the
+// response of the next handler before sending it.
+type responseBuffer struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = status
+	b.wroteHeader = true
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// copyHeader copies the buffered header to w.
+func (b *responseBuffer) copyHeader(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+}
+
+// writeTo sends the buffered header and status with body, e.g. the rewritten buffered body, to w.
+func (b *responseBuffer) writeTo(w http.ResponseWriter, body []byte) {
+	b.copyHeader(w)
+	w.WriteHeader(b.status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,617 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	"github.com/elimity-com/scim/schema"
+	"github.com/sirupsen/logrus"
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// Verify SchemaResourceHandler is of type scim.ResourceHandler
+var _ scim.ResourceHandler = &SchemaResourceHandler{}
+
+// SchemaResourceHandler serves the resources of a resource type, e.g. users or groups, from a Store. The behavior
+// specific to a resource type follows from its schema: attributes declared unique, such as the userName of users, are
+// checked on writes, never returned attributes such as the password are stored hashed, and an "active" attribute is
+// set on creation WithDefaultActive.
+type SchemaResourceHandler struct {
+	// resourceType is the name of the resource type, e.g. "User", as reported in meta.resourceType
+	resourceType string
+	store        Store
+	logger       *logrus.Logger
+	// schema declares the attribute names patch operations are normalized to
+	schema schema.Schema
+	// maxResults is the maximum number of resources returned by GetAll
+	maxResults int
+	// uniqueness serializes the checks of unique attributes with the writes they guard, so concurrent creates with the
+	// same userName can't both pass the check. It only covers writes of this process.
+	uniqueness *sync.Mutex
+	options
+}
+
+func NewSchemaResourceHandler(l *logrus.Logger, resourceType string, s Store, sc schema.Schema, maxResults int, opts ...Option) SchemaResourceHandler {
+	return SchemaResourceHandler{
+		resourceType: resourceType,
+		store:        s,
+		logger:       l,
+		schema:       sc,
+		maxResults:   maxResults,
+		uniqueness:   &sync.Mutex{},
+		options:      newOptions(opts),
+	}
+}
+
+// log returns the handler logger tagged with the request ID of r.
+func (h SchemaResourceHandler) log(r *http.Request) *logrus.Entry {
+	return RequestLogger(h.logger, r)
+}
+
+// name returns the name of the resource type for log messages, e.g. "user".
+func (h SchemaResourceHandler) name() string {
+	return strings.ToLower(h.resourceType)
+}
+
+func (h SchemaResourceHandler) Create(r *http.Request, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	h.log(r).Infof("Creating new %s %v ", h.name(), withoutNeverReturned(h.schema, attributes))
+	h.uniqueness.Lock()
+	defer h.uniqueness.Unlock()
+
+	if err := h.checkCreate(attributes); err != nil {
+		return scim.Resource{}, err
+	}
+
+	// create unique identifier
+	id := h.idGenerator.NewID()
+	_, err := h.store.Get(id)
+	if err == nil {
+		return scim.Resource{}, fmt.Errorf("generated %s id %s already exists", h.name(), id)
+	}
+	if err != ErrNotFound {
+		return scim.Resource{}, err
+	}
+
+	normalizePrimary(nil, attributes)
+	warnUnusableExternalID(h.log(r), attributes)
+	return h.insert(r, id, attributes)
+}
+
+// insert stores a new resource with the given id.
+func (h SchemaResourceHandler) insert(r *http.Request, id string, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	if err := hashPassword(nil, attributes); err != nil {
+		return scim.Resource{}, err
+	}
+	if _, ok := attributeKey(attributes, "active"); !ok && h.defaultActive {
+		if _, declared := h.schema.Attributes.ContainsAttribute("active"); declared {
+			attributes["active"] = true
+		}
+	}
+
+	now := h.now()
+	version := nextVersion("")
+
+	// store resource
+	err := h.store.Put(Record{
+		ID:         id,
+		Attributes: attributes,
+		Meta: map[string]string{
+			"created":      now.Format(time.RFC3339),
+			"lastModified": now.Format(time.RFC3339),
+			"version":      version,
+		},
+	})
+	if err != nil {
+		return scim.Resource{}, err
+	}
+
+	h.audit(h.log(r), r, AuditEntry{Operation: AuditCreate, ResourceType: h.resourceType, ID: id, AfterVersion: version})
+
+	// return stored resource
+	return scim.Resource{
+		ID:         id,
+		ExternalID: externalID(attributes),
+		Attributes: withoutNeverReturned(h.schema, attributes),
+		Meta: scim.Meta{
+			Created:      &now,
+			LastModified: &now,
+			Version:      h.etag(version),
+		},
+	}, nil
+}
+
+func (h SchemaResourceHandler) Delete(r *http.Request, id string) error {
+	h.log(r).Infof("Deleting %s %s", h.name(), id)
+
+	var deleted Record
+	if h.auditLog != nil {
+		// the deleted version for the audit log
+		deleted, _ = h.store.Get(id)
+	}
+
+	// delete resource
+	err := h.store.Delete(id)
+	if err == nil {
+		h.audit(h.log(r), r, AuditEntry{Operation: AuditDelete, ResourceType: h.resourceType, ID: id, BeforeVersion: deleted.Meta["version"]})
+	}
+	if err == ErrNotFound && h.idempotentDelete {
+		return nil
+	}
+	if err == ErrNotFound {
+		return errors.ScimErrorResourceNotFound(id)
+	}
+	return err
+}
+
+// Reset deletes all resources.
+func (h SchemaResourceHandler) Reset(r *http.Request) error {
+	h.log(r).Warnf("Deleting all %s resources", h.name())
+	return h.store.DeleteAll()
+}
+
+// Snapshot returns all resources without the attributes that are never returned, e.g. the password.
+func (h SchemaResourceHandler) Snapshot() ([]scim.Resource, error) {
+	resources, err := snapshot(h.store)
+	if err != nil {
+		return nil, err
+	}
+	for i, resource := range resources {
+		resources[i].Attributes = withoutNeverReturned(h.schema, resource.Attributes)
+	}
+	return resources, nil
+}
+
+// Walk calls fn with each resource, one at a time if the store can read them that way. The attributes that are never
+// returned, e.g. the password, are left out.
+func (h SchemaResourceHandler) Walk(fn func(resource scim.Resource) error) error {
+	return walkResources(h.store, func(resource scim.Resource) error {
+		resource.Attributes = withoutNeverReturned(h.schema, resource.Attributes)
+		return fn(resource)
+	})
+}
+
+// Restore stores the given resources, overwriting resources with the same id. Like on creation the attributes are
+// validated, unique attributes are checked and the password, which is given in cleartext, is hashed.
+func (h SchemaResourceHandler) Restore(resources []scim.Resource) error {
+	h.uniqueness.Lock()
+	defer h.uniqueness.Unlock()
+
+	return restore(h.store, h.idGenerator, resources, h.now(), func(id string, attributes scim.ResourceAttributes) error {
+		if err := validateAttributes(h.schema, attributes); err != nil {
+			return err
+		}
+		if err := h.checkUnique(attributes, id); err != nil {
+			return err
+		}
+		normalizePrimary(nil, attributes)
+		return hashPassword(nil, attributes)
+	})
+}
+
+// Undelete restores the deleted resource with the given id if the store keeps deleted resources.
+func (h SchemaResourceHandler) Undelete(r *http.Request, id string) error {
+	h.log(r).Infof("Undeleting %s %s", h.name(), id)
+	h.uniqueness.Lock()
+	defer h.uniqueness.Unlock()
+
+	return undelete(h.store, id, h.checkCreate)
+}
+
+func (h SchemaResourceHandler) Get(r *http.Request, id string) (scim.Resource, error) {
+	h.log(r).Infof("Getting %s %s", h.name(), id)
+
+	// check if resource exists
+	data, err := h.store.Get(id)
+	if err == ErrNotFound {
+		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
+	}
+	if err != nil {
+		return scim.Resource{}, err
+	}
+
+	created, _ := time.ParseInLocation(time.RFC3339, data.Meta["created"], time.UTC)
+	lastModified, _ := time.ParseInLocation(time.RFC3339, data.Meta["lastModified"], time.UTC)
+	attributes := projectAttributes(r, h.schema, data.Attributes)
+
+	// return resource with given identifier
+	return scim.Resource{
+		ID:         id,
+		ExternalID: externalID(attributes),
+		Attributes: attributes,
+		Meta: scim.Meta{
+			Created:      &created,
+			LastModified: &lastModified,
+			Version:      h.etag(data.Meta["version"]),
+		},
+	}, nil
+}
+
+func (h SchemaResourceHandler) GetAll(r *http.Request, params scim.ListRequestParams) (scim.Page, error) {
+	h.log(r).Infof("Getting all %s resources", h.name())
+	// Parse the filter
+	// When creating a user Okta will call GetAll and check by username to make sure that the username is unique
+	var expr filter.Expression
+	if f := listFilter(r); f != "" {
+		var err error
+		expr, err = filter.Parse(f)
+		if err != nil {
+			h.log(r).Errorf("Failed to parse filter %q: %v", f, err)
+			return scim.Page{}, invalidFilter(f, err)
+		}
+		applyCaseExact(h.schema.ID, h.schema.Attributes, expr)
+	}
+
+	records, err := listMatching(h.store, expr)
+	if err != nil {
+		return scim.Page{}, err
+	}
+
+	resources := make([]scim.Resource, 0)
+	for _, v := range records {
+		// attributes that are never returned can't be filtered by either
+		attributes := withoutNeverReturned(h.schema, v.Attributes)
+		if expr != nil && !expr.Matches(filterAttributes(v, attributes, h.resourceType)) {
+			continue
+		}
+
+		resources = append(resources, scim.Resource{
+			ID:         v.ID,
+			ExternalID: externalID(attributes),
+			Attributes: attributes,
+		})
+	}
+
+	params.Count = clampCount(params.Count, h.maxResults)
+	if params.Count == 0 {
+		// only the number of matching resources is requested
+		return scim.Page{
+			TotalResults: len(resources),
+			Resources:    []scim.Resource{},
+		}, nil
+	}
+
+	// map iteration order is random, always sort so successive pages are consistent
+	sortResources(resources, r.URL.Query().Get("sortBy"), r.URL.Query().Get("sortOrder"))
+
+	page := paginate(resources, params)
+	for i, resource := range page {
+		page[i].Attributes = projectAttributes(r, h.schema, resource.Attributes)
+		page[i].ExternalID = externalID(page[i].Attributes)
+	}
+
+	return scim.Page{
+		TotalResults: len(resources),
+		Resources:    page,
+	}, nil
+}
+
+func (h SchemaResourceHandler) Patch(r *http.Request, id string, operations []scim.PatchOperation) (scim.Resource, error) {
+	h.log(r).Infof("Patching %s %s", h.name(), id)
+	if len(operations) == 0 {
+		// RFC 7644 section 3.5.2 requires one or more operations, none would otherwise leave the resource unchanged
+		// and respond 204
+		return scim.Resource{}, errors.ScimErrorBadRequest("The request has no operations, at least one is required.")
+	}
+	if h.maxPatchOperations > 0 && len(operations) > h.maxPatchOperations {
+		return scim.Resource{}, errors.ScimError{
+			Detail: fmt.Sprintf("The request has %d operations, the maximum is %d.", len(operations), h.maxPatchOperations),
+			Status: http.StatusBadRequest,
+		}
+	}
+	operations = normalizeOperations(h.schema, operations)
+
+	h.uniqueness.Lock()
+	defer h.uniqueness.Unlock()
+	// the store can't be read while it patches the record, so the other records are read before, uniqueness keeps
+	// their unique attributes from changing in between
+	others, err := h.store.List()
+	if err != nil {
+		return scim.Resource{}, err
+	}
+
+	var noContent bool
+	now := h.now()
+	var before string
+	data, err := h.store.PatchWithVersion(id, r.Header.Get("If-Match"), func(data *Record) error {
+		before = data.Meta["version"]
+		if shouldReturnNoContent(h.schema, *data, operations) {
+			noContent = true
+			return nil
+		}
+
+		previous := copyAttributes(data.Attributes)
+		for _, op := range operations {
+			expr, err := valueFilter(h.schema, op)
+			if err != nil {
+				return err
+			}
+
+			switch op.Op {
+			case scim.PatchOperationAdd:
+				if expr != nil {
+					if err := updateMatching(data.Attributes, op, expr); err != nil {
+						return err
+					}
+				} else if op.Path != nil {
+					keys := pathKeys(h.schema, op)
+					if err := setPath(data.Attributes, keys, appendValue(getPath(data.Attributes, keys), op.Value)); err != nil {
+						return err
+					}
+				} else {
+					valueMap, ok := op.Value.(map[string]interface{})
+					if !ok {
+						return errors.ScimErrorInvalidValue
+					}
+					for k, v := range valueMap {
+						data.Attributes[k] = appendValue(data.Attributes[k], v)
+					}
+				}
+			case scim.PatchOperationReplace:
+				if expr != nil {
+					if err := updateMatching(data.Attributes, op, expr); err != nil {
+						return err
+					}
+				} else if op.Path != nil {
+					if err := setPath(data.Attributes, pathKeys(h.schema, op), op.Value); err != nil {
+						return err
+					}
+				} else {
+					valueMap, ok := op.Value.(map[string]interface{})
+					if !ok {
+						return errors.ScimErrorInvalidValue
+					}
+					for k, v := range valueMap {
+						data.Attributes[k] = v
+					}
+				}
+			case scim.PatchOperationRemove:
+				if expr != nil {
+					removeMatching(data.Attributes, op, expr)
+				} else if op.Value != nil {
+					// e.g. Azure AD removes members with a "members" path and the members to remove as the value
+					keys := pathKeys(h.schema, op)
+					if err := setPath(data.Attributes, keys, removeValues(getPath(data.Attributes, keys), op.Value)); err != nil {
+						return err
+					}
+				} else {
+					removePath(data.Attributes, pathKeys(h.schema, op))
+				}
+			}
+		}
+		normalizePrimary(previous, data.Attributes)
+		if err := hashPassword(previous, data.Attributes); err != nil {
+			return err
+		}
+		if err := checkMutability(h.schema, h.schemaExtensions, previous, data.Attributes); err != nil {
+			return err
+		}
+		if err := validateAttributes(h.schema, data.Attributes); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(previous, data.Attributes) {
+			// keep lastModified and the version for delta syncs
+			return nil
+		}
+		if err := h.checkUniqueIn(others, data.Attributes, id); err != nil {
+			return err
+		}
+
+		// store the new version so the returned ETag matches the one of a subsequent Get
+		data.Meta["lastModified"] = now.Format(time.RFC3339)
+		data.Meta["version"] = nextVersion(data.Meta["version"])
+		return nil
+	})
+	if err == ErrNotFound {
+		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
+	}
+	if err == ErrVersionMismatch {
+		return scim.Resource{}, preconditionFailed(r)
+	}
+	if err != nil {
+		return scim.Resource{}, err
+	}
+	if noContent {
+		return scim.Resource{}, nil
+	}
+	if data.Meta["version"] != before {
+		h.audit(h.log(r), r, AuditEntry{Operation: AuditPatch, ResourceType: h.resourceType, ID: id, BeforeVersion: before, AfterVersion: data.Meta["version"]})
+	}
+	warnUnusableExternalID(h.log(r), data.Attributes)
+
+	created, _ := time.ParseInLocation(time.RFC3339, data.Meta["created"], time.UTC)
+	lastModified, _ := time.ParseInLocation(time.RFC3339, data.Meta["lastModified"], time.UTC)
+
+	// return resource with patched attributes
+	return scim.Resource{
+		ID:         id,
+		ExternalID: externalID(data.Attributes),
+		Attributes: withoutNeverReturned(h.schema, data.Attributes),
+		Meta: scim.Meta{
+			Created:      &created,
+			LastModified: &lastModified,
+			Version:      h.etag(data.Meta["version"]),
+		},
+	}, nil
+}
+
+func (h SchemaResourceHandler) Replace(r *http.Request, id string, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	h.log(r).Infof("Replacing %s %v", h.name(), id)
+
+	if err := validateAttributes(h.schema, attributes); err != nil {
+		return scim.Resource{}, err
+	}
+	warnUnusableExternalID(h.log(r), attributes)
+	h.uniqueness.Lock()
+	defer h.uniqueness.Unlock()
+
+	if err := h.checkUnique(attributes, id); err != nil {
+		return scim.Resource{}, err
+	}
+
+	// replace (all) attributes
+	now := h.now()
+	var before string
+	data, err := h.store.PatchWithVersion(id, r.Header.Get("If-Match"), func(data *Record) error {
+		before = data.Meta["version"]
+		// keep created, the rest of the meta reflects this replace
+		normalizePrimary(nil, attributes)
+		keepPassword(data.Attributes, attributes)
+		if err := hashPassword(data.Attributes, attributes); err != nil {
+			return err
+		}
+		keepUnmodifiable(h.schema, h.schemaExtensions, data.Attributes, attributes)
+		if err := checkMutability(h.schema, h.schemaExtensions, data.Attributes, attributes); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(data.Attributes, attributes) {
+			return nil
+		}
+		data.Attributes = attributes
+		data.Meta["lastModified"] = now.Format(time.RFC3339)
+		data.Meta["version"] = nextVersion(data.Meta["version"])
+		return nil
+	})
+	if err == ErrNotFound && h.upsertOnPut {
+		h.log(r).Infof("Creating %s %s on replace", h.name(), id)
+		if err := h.checkCreate(attributes); err != nil {
+			return scim.Resource{}, err
+		}
+		normalizePrimary(nil, attributes)
+		return h.insert(r, id, attributes)
+	}
+	if err == ErrNotFound {
+		return scim.Resource{}, errors.ScimErrorResourceNotFound(id)
+	}
+	if err == ErrVersionMismatch {
+		return scim.Resource{}, preconditionFailed(r)
+	}
+	if err != nil {
+		return scim.Resource{}, err
+	}
+	if data.Meta["version"] != before {
+		h.audit(h.log(r), r, AuditEntry{Operation: AuditReplace, ResourceType: h.resourceType, ID: id, BeforeVersion: before, AfterVersion: data.Meta["version"]})
+	}
+
+	created, _ := time.ParseInLocation(time.RFC3339, data.Meta["created"], time.UTC)
+	lastModified, _ := time.ParseInLocation(time.RFC3339, data.Meta["lastModified"], time.UTC)
+
+	// return resource with replaced attributes
+	return scim.Resource{
+		ID:         id,
+		ExternalID: externalID(data.Attributes),
+		Attributes: withoutNeverReturned(h.schema, data.Attributes),
+		Meta: scim.Meta{
+			Created:      &created,
+			LastModified: &lastModified,
+			Version:      h.etag(data.Meta["version"]),
+		},
+	}, nil
+}
+
+// checkCreate returns an error if a resource with the given attributes can't be created.
+func (h SchemaResourceHandler) checkCreate(attributes scim.ResourceAttributes) error {
+	if err := validateAttributes(h.schema, attributes); err != nil {
+		return err
+	}
+	return h.checkUnique(attributes, "")
+}
+
+// checkUnique returns a uniqueness error if a resource other than exceptID has the same value for one of the string
+// attributes the schema declares unique, e.g. userName. Values are compared case-insensitively unless the attribute is
+// case exact.
+func (h SchemaResourceHandler) checkUnique(attributes scim.ResourceAttributes, exceptID string) error {
+	if !h.hasUnique(attributes) {
+		return nil
+	}
+	records, err := h.store.List()
+	if err != nil {
+		return err
+	}
+	return h.checkUniqueIn(records, attributes, exceptID)
+}
+
+// hasUnique reports whether attributes have a value for one of the attributes the schema declares unique.
+func (h SchemaResourceHandler) hasUnique(attributes scim.ResourceAttributes) bool {
+	for _, attr := range h.schema.Attributes {
+		if _, ok := uniqueValue(attributes, attr.Name()); ok && attr.Uniqueness() != "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUniqueIn is checkUnique against the given records instead of those of the store.
+func (h SchemaResourceHandler) checkUniqueIn(records []Record, attributes scim.ResourceAttributes, exceptID string) error {
+	var unique []schema.CoreAttribute
+	values := make(map[string]string)
+	for _, attr := range h.schema.Attributes {
+		if attr.Uniqueness() == "none" {
+			continue
+		}
+		if v, ok := uniqueValue(attributes, attr.Name()); ok {
+			unique = append(unique, attr)
+			values[attr.Name()] = v
+		}
+	}
+
+	for _, record := range records {
+		if record.ID == exceptID {
+			continue
+		}
+		for _, attr := range unique {
+			v, ok := uniqueValue(record.Attributes, attr.Name())
+			if !ok {
+				continue
+			}
+			if value := values[attr.Name()]; v == value || (!attr.CaseExact() && strings.EqualFold(v, value)) {
+				return errors.ScimErrorUniqueness
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueValue returns the string value of the named attribute, the externalId as returned by externalID.
+func uniqueValue(attributes scim.ResourceAttributes, name string) (string, bool) {
+	if strings.EqualFold(name, "externalId") {
+		eID := externalID(attributes)
+		return eID.Value(), eID.Present()
+	}
+	k, ok := attributeKey(attributes, name)
+	if !ok {
+		return "", false
+	}
+	v, ok := attributes[k].(string)
+	return v, ok
+}
+
+// clampCount limits the requested count to maxResults.
+func clampCount(count, maxResults int) int {
+	if count > maxResults {
+		return maxResults
+	}
+	return count
+}
+
+// paginate returns at most params.Count resources starting at the 1-based params.StartIndex.
+// The list response reports params.StartIndex and params.Count as startIndex and itemsPerPage.
+func paginate(resources []scim.Resource, params scim.ListRequestParams) []scim.Resource {
+	start := params.StartIndex - 1
+	if start < 0 {
+		start = 0
+	}
+	if start > len(resources) {
+		start = len(resources)
+	}
+	end := len(resources)
+	if params.Count < end-start {
+		end = start + params.Count
+	}
+	return resources[start:end]
+}
@@ -0,0 +1,608 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+)
+
+// TestConcurrentOperations runs creates, gets, patches, deletes and lists at the same time, run it with -race.
+func TestConcurrentOperations(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			resource, err := h.Create(r, scim.ResourceAttributes{"userName": fmt.Sprintf("user%d", i)})
+			if err != nil {
+				t.Errorf("Create: %v", err)
+				return
+			}
+			if _, err := h.Get(r, resource.ID); err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			if _, err := h.Patch(r, resource.ID, []scim.PatchOperation{
+				{Op: scim.PatchOperationReplace, Value: map[string]interface{}{"nickName": fmt.Sprintf("nick%d", i)}},
+			}); err != nil {
+				t.Errorf("Patch: %v", err)
+			}
+			if _, err := h.GetAll(r, scim.ListRequestParams{StartIndex: 1, Count: 100}); err != nil {
+				t.Errorf("GetAll: %v", err)
+			}
+			if i%2 == 0 {
+				if err := h.Delete(r, resource.ID); err != nil {
+					t.Errorf("Delete: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	page, err := h.GetAll(r, scim.ListRequestParams{StartIndex: 1, Count: 100})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if page.TotalResults != 25 {
+		t.Errorf("got %d users, want 25", page.TotalResults)
+	}
+}
+
+func TestCreateMetaRoundTrip(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := newTestUserHandler(WithClock(newFakeClock(start)))
+	r := testRequest()
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	got, err := h.Get(r, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if got.Meta.Created == nil || !got.Meta.Created.Equal(start) {
+		t.Errorf("got created %v, want %v", got.Meta.Created, start)
+	}
+	if got.Meta.LastModified == nil || !got.Meta.LastModified.Equal(start) {
+		t.Errorf("got lastModified %v, want %v", got.Meta.LastModified, start)
+	}
+	if got.Meta.Version == "" || got.Meta.Version != created.Meta.Version {
+		t.Errorf("got version %q, want %q", got.Meta.Version, created.Meta.Version)
+	}
+}
+
+func TestGroupWithMembers(t *testing.T) {
+	h := NewSchemaResourceHandler(testLogger(), "Group", NewMemoryStore(), testGroupSchema(), 100)
+	r := testRequest()
+
+	members := []interface{}{
+		map[string]interface{}{"value": "2819c223", "display": "Babs Jensen"},
+		map[string]interface{}{"value": "902c246b", "display": "Mandy Pepperidge"},
+	}
+	created, err := h.Create(r, scim.ResourceAttributes{"displayName": "Tour Guides", "members": members})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := h.Get(r, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Attributes["displayName"] != "Tour Guides" {
+		t.Errorf("got displayName %v, want %q", got.Attributes["displayName"], "Tour Guides")
+	}
+	if !reflect.DeepEqual(got.Attributes["members"], members) {
+		t.Errorf("got members %v, want %v", got.Attributes["members"], members)
+	}
+}
+
+// createUsers creates n users named user01, user02 and so on with h and returns their ids.
+func createUsers(t *testing.T, h SchemaResourceHandler, n int) []string {
+	t.Helper()
+
+	ids := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		resource, err := h.Create(testRequest(), scim.ResourceAttributes{"userName": fmt.Sprintf("user%02d", i)})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, resource.ID)
+	}
+	return ids
+}
+
+func TestGetAllPagination(t *testing.T) {
+	h := newTestUserHandler()
+	createUsers(t, h, 25)
+
+	tests := []struct {
+		startIndex, count int
+		want              int
+	}{
+		{1, 10, 10},
+		{11, 10, 10},
+		{21, 10, 5},
+		{31, 10, 0},
+	}
+	for _, test := range tests {
+		page, err := h.GetAll(testRequest(), scim.ListRequestParams{StartIndex: test.startIndex, Count: test.count})
+		if err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+		if page.TotalResults != 25 {
+			t.Errorf("startIndex %d: got totalResults %d, want 25", test.startIndex, page.TotalResults)
+		}
+		if len(page.Resources) != test.want {
+			t.Errorf("startIndex %d: got %d resources, want %d", test.startIndex, len(page.Resources), test.want)
+		}
+	}
+}
+
+func TestGetAllPagesAreDisjoint(t *testing.T) {
+	h := newTestUserHandler()
+	ids := createUsers(t, h, 15)
+
+	seen := make(map[string]bool)
+	for _, startIndex := range []int{1, 9} {
+		page, err := h.GetAll(testRequest(), scim.ListRequestParams{StartIndex: startIndex, Count: 8})
+		if err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+		for _, resource := range page.Resources {
+			if seen[resource.ID] {
+				t.Errorf("got %s on more than one page", resource.ID)
+			}
+			seen[resource.ID] = true
+		}
+	}
+
+	for _, id := range ids {
+		if !seen[id] {
+			t.Errorf("got no page with %s", id)
+		}
+	}
+	if len(seen) != len(ids) {
+		t.Errorf("got %d resources, want %d", len(seen), len(ids))
+	}
+}
+
+func TestGetAllSort(t *testing.T) {
+	h := newTestUserHandler()
+	for _, userName := range []string{"mjones", "Bjensen", "jsmith"} {
+		if _, err := h.Create(testRequest(), scim.ResourceAttributes{"userName": userName}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?sortBy=userName", []string{"Bjensen", "jsmith", "mjones"}},
+		{"?sortBy=userName&sortOrder=ascending", []string{"Bjensen", "jsmith", "mjones"}},
+		{"?sortBy=userName&sortOrder=descending", []string{"mjones", "jsmith", "Bjensen"}},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/Users"+test.query, nil)
+		page, err := h.GetAll(r, scim.ListRequestParams{StartIndex: 1, Count: 10})
+		if err != nil {
+			t.Fatalf("GetAll: %v", err)
+		}
+		var got []string
+		for _, resource := range page.Resources {
+			got = append(got, resource.Attributes["userName"].(string))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestCreateDuplicateUserName(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+
+	w := serve(server, http.MethodPost, "/Users", `{"userName": "BJensen"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if scimType := decodeBody(t, w)["scimType"]; scimType != "uniqueness" {
+		t.Errorf("got scimType %v, want uniqueness", scimType)
+	}
+}
+
+func TestPatchDuplicateUserName(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+	id := mustCreate(t, server, "/Users", `{"userName": "jsmith"}`)
+
+	w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "userName", "value": "BJensen"}]`))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if scimType := decodeBody(t, w)["scimType"]; scimType != "uniqueness" {
+		t.Errorf("got scimType %v, want uniqueness", scimType)
+	}
+	if user := decodeBody(t, serve(server, http.MethodGet, "/Users/"+id, "")); user["userName"] != "jsmith" {
+		t.Errorf("got userName %v, want it unchanged", user["userName"])
+	}
+
+	// a change of its own case is not a duplicate
+	if w := serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "replace", "path": "userName", "value": "JSmith"}]`)); w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestExternalIDConflicts(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+	mustCreate(t, server, "/Users", `{"userName": "bjensen", "externalId": "701984"}`)
+	id := mustCreate(t, server, "/Users", `{"userName": "jsmith", "externalId": "701985"}`)
+
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"create", http.MethodPost, "/Users", `{"userName": "mjones", "externalId": "701984"}`, http.StatusConflict},
+		{"create with another externalId", http.MethodPost, "/Users", `{"userName": "mjones", "externalId": "701986"}`, http.StatusCreated},
+		{"replace", http.MethodPut, "/Users/" + id, `{"userName": "jsmith", "externalId": "701984"}`, http.StatusConflict},
+		{"replace keeping its own", http.MethodPut, "/Users/" + id, `{"userName": "jsmith", "externalId": "701985"}`, http.StatusOK},
+		{"patch", http.MethodPatch, "/Users/" + id, patchBody(`[{"op": "replace", "path": "externalId", "value": "701984"}]`), http.StatusConflict},
+		{"patch without a path", http.MethodPatch, "/Users/" + id, patchBody(`[{"op": "add", "value": {"externalId": "701984"}}]`), http.StatusConflict},
+		{"patch to an unused one", http.MethodPatch, "/Users/" + id, patchBody(`[{"op": "replace", "path": "externalId", "value": "701987"}]`), http.StatusOK},
+	}
+	for _, test := range tests {
+		w := serve(server, test.method, test.target, test.body)
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, w.Code, test.want, w.Body.String())
+		}
+	}
+}
+
+func TestCreateName(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+	name := map[string]interface{}{
+		"formatted":  "Ms. Barbara J Jensen, III",
+		"familyName": "Jensen",
+		"givenName":  "Barbara",
+	}
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen", "name": name})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	got, err := h.Get(r, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got.Attributes["name"], name) {
+		t.Errorf("got name %v, want %v", got.Attributes["name"], name)
+	}
+}
+
+func TestCreateTwoEmails(t *testing.T) {
+	h := newTestUserHandler()
+	r := testRequest()
+	emails := []interface{}{
+		map[string]interface{}{"value": "bjensen@example.com", "type": "work"},
+		map[string]interface{}{"value": "babs@jensen.org", "type": "home"},
+	}
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen", "emails": emails})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !reflect.DeepEqual(created.Attributes["emails"], emails) {
+		t.Errorf("Create: got emails %v, want %v", created.Attributes["emails"], emails)
+	}
+	got, err := h.Get(r, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got.Attributes["emails"], emails) {
+		t.Errorf("Get: got emails %v, want %v", got.Attributes["emails"], emails)
+	}
+}
+
+func TestReplaceKeepsCreated(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	h := newTestUserHandler(WithClock(clock))
+	r := testRequest()
+
+	created, err := h.Create(r, scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	clock.Advance(time.Hour)
+	replaced, err := h.Replace(r, created.ID, scim.ResourceAttributes{"userName": "bjensen", "nickName": "Babs"})
+	if err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+
+	for name, resource := range map[string]scim.Resource{"Replace": replaced, "Get": mustGet(t, h, created.ID)} {
+		if !resource.Meta.Created.Equal(start) {
+			t.Errorf("%s: got created %v, want %v", name, resource.Meta.Created, start)
+		}
+		if want := start.Add(time.Hour); !resource.Meta.LastModified.Equal(want) {
+			t.Errorf("%s: got lastModified %v, want %v", name, resource.Meta.LastModified, want)
+		}
+		if resource.Meta.Version == "" || resource.Meta.Version == created.Meta.Version {
+			t.Errorf("%s: got version %q, want a new one", name, resource.Meta.Version)
+		}
+	}
+}
+
+// mustGet returns the resource with the given id of h.
+func mustGet(t *testing.T, h SchemaResourceHandler, id string) scim.Resource {
+	t.Helper()
+
+	resource, err := h.Get(testRequest(), id)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return resource
+}
+
+func TestReplaceMissing(t *testing.T) {
+	const body = `{"userName": "bjensen"}`
+
+	t.Run("not found", func(t *testing.T) {
+		users := newTestUserHandler()
+		server := newTestServer(t, users, newTestGroupHandler())
+
+		w := serve(server, http.MethodPut, "/Users/missing", body)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusNotFound, w.Body.String())
+		}
+		if _, err := users.Get(testRequest(), "missing"); err == nil {
+			t.Error("Get: got the resource, want it not created")
+		}
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		users := newTestUserHandler(WithUpsertOnPut())
+		server := newTestServer(t, users, newTestGroupHandler())
+
+		w := serve(server, http.MethodPut, "/Users/missing", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		if got := decodeBody(t, w)["id"]; got != "missing" {
+			t.Errorf("got id %v, want missing", got)
+		}
+		resource := mustGet(t, users, "missing")
+		if resource.Attributes["userName"] != "bjensen" || resource.Meta.Created == nil {
+			t.Errorf("Get: got %+v, want the created user", resource)
+		}
+
+		// the created user's unique attributes are taken
+		if w := serve(server, http.MethodPut, "/Users/other", body); w.Code != http.StatusConflict {
+			t.Errorf("upsert of a taken userName: got status %d, want %d", w.Code, http.StatusConflict)
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		wantMissing int
+	}{
+		{"strict", nil, http.StatusNotFound},
+		{"idempotent", []Option{WithIdempotentDelete()}, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users := newTestUserHandler(test.opts...)
+			server := newTestServer(t, users, newTestGroupHandler())
+			id := mustCreate(t, server, "/Users", `{"userName": "bjensen"}`)
+
+			w := serve(server, http.MethodDelete, "/Users/"+id, "")
+			if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+				t.Fatalf("DELETE: got status %d with body %q, want %d without one", w.Code, w.Body.String(), http.StatusNoContent)
+			}
+			if w := serve(server, http.MethodGet, "/Users/"+id, ""); w.Code != http.StatusNotFound {
+				t.Errorf("GET after DELETE: got status %d, want %d", w.Code, http.StatusNotFound)
+			}
+
+			// a retried delete
+			if w := serve(server, http.MethodDelete, "/Users/"+id, ""); w.Code != test.wantMissing {
+				t.Errorf("second DELETE: got status %d, want %d", w.Code, test.wantMissing)
+			}
+			if w := serve(server, http.MethodDelete, "/Users/missing", ""); w.Code != test.wantMissing {
+				t.Errorf("DELETE of a missing id: got status %d, want %d", w.Code, test.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCreateDefaultActive(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		attributes scim.ResourceAttributes
+		want       interface{}
+	}{
+		{"default", []Option{WithDefaultActive()}, scim.ResourceAttributes{"userName": "bjensen"}, true},
+		{"inactive", []Option{WithDefaultActive()}, scim.ResourceAttributes{"userName": "bjensen", "active": false}, false},
+		{"no default", nil, scim.ResourceAttributes{"userName": "bjensen"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestUserHandler(test.opts...)
+			created, err := h.Create(testRequest(), test.attributes)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if got := created.Attributes["active"]; got != test.want {
+				t.Errorf("Create: got active %v, want %v", got, test.want)
+			}
+			if got := mustGet(t, h, created.ID).Attributes["active"]; got != test.want {
+				t.Errorf("Get: got active %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetAllCountZero(t *testing.T) {
+	users := newTestUserHandler()
+	server := newTestServer(t, users, newTestGroupHandler())
+	createUsers(t, users, 12)
+
+	w := serve(server, http.MethodGet, "/Users?count=0&filter="+url.QueryEscape(`userName sw "user0"`), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	body := decodeBody(t, w)
+	if body["totalResults"] != json.Number("9") {
+		t.Errorf("got totalResults %v, want 9", body["totalResults"])
+	}
+	if resources, _ := body["Resources"].([]interface{}); len(resources) != 0 {
+		t.Errorf("got %d resources, want none", len(resources))
+	}
+}
+
+func TestConcurrentIdenticalCreates(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		h := newTestUserHandler()
+		start := make(chan struct{})
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				_, errs[i] = h.Create(testRequest(), scim.ResourceAttributes{"userName": "bjensen", "externalId": "701984"})
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			if scimErr, ok := err.(errors.ScimError); !ok || scimErr.Status != http.StatusConflict {
+				t.Errorf("Create: got error %v, want a uniqueness conflict", err)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("round %d: got %d creates succeeding, want exactly 1", round, succeeded)
+		}
+		if page, _ := h.GetAll(testRequest(), scim.ListRequestParams{StartIndex: 1, Count: 10}); page.TotalResults != 1 {
+			t.Fatalf("round %d: got %d users, want 1", round, page.TotalResults)
+		}
+	}
+}
+
+func TestMetaResourceType(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	tests := []struct {
+		endpoint, body, want string
+	}{
+		{"/Users", `{"userName": "bjensen"}`, "User"},
+		{"/Groups", `{"displayName": "Tour Guides"}`, "Group"},
+	}
+	for _, test := range tests {
+		w := serve(server, http.MethodPost, test.endpoint, test.body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("POST %s: got status %d, want %d: %s", test.endpoint, w.Code, http.StatusCreated, w.Body.String())
+		}
+		created := decodeBody(t, w)
+		id := created["id"].(string)
+
+		responses := map[string]map[string]interface{}{
+			"POST": created,
+			"GET":  decodeBody(t, serve(server, http.MethodGet, test.endpoint+"/"+id, "")),
+		}
+		list, _ := decodeBody(t, serve(server, http.MethodGet, test.endpoint, ""))["Resources"].([]interface{})
+		if len(list) == 1 {
+			responses["list"] = list[0].(map[string]interface{})
+		} else {
+			t.Errorf("GET %s: got %d resources, want 1", test.endpoint, len(list))
+		}
+		for name, resource := range responses {
+			if meta, _ := resource["meta"].(map[string]interface{}); meta["resourceType"] != test.want {
+				t.Errorf("%s %s: got meta.resourceType %v, want %s", name, test.endpoint, meta["resourceType"], test.want)
+			}
+		}
+	}
+}
+
+func TestSchemaResourceHandlerCRUD(t *testing.T) {
+	tests := []struct {
+		name             string
+		h                SchemaResourceHandler
+		required, attr   string
+		created, patched string
+	}{
+		{"User", newTestUserHandler(), "userName", "nickName", "Babs", "Barbara"},
+		{"Group", newTestGroupHandler(), "displayName", "externalId", "guides", "drivers"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := testRequest()
+			created, err := test.h.Create(r, scim.ResourceAttributes{test.required: "a", test.attr: test.created})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if got := mustGet(t, test.h, created.ID); got.Attributes[test.attr] != test.created {
+				t.Errorf("Get: got %s %v, want %s", test.attr, got.Attributes[test.attr], test.created)
+			}
+			// the required attribute of the schema is checked
+			if _, err := test.h.Create(r, scim.ResourceAttributes{test.attr: test.created}); err == nil {
+				t.Errorf("Create without %s: got no error", test.required)
+			}
+
+			if _, err := test.h.Replace(r, created.ID, scim.ResourceAttributes{test.required: "b"}); err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if got := mustGet(t, test.h, created.ID); got.Attributes[test.required] != "b" || got.Attributes[test.attr] != nil {
+				t.Errorf("Replace: got %v, want only %s b", got.Attributes, test.required)
+			}
+
+			if _, err := test.h.Patch(r, created.ID, []scim.PatchOperation{
+				{Op: scim.PatchOperationAdd, Value: map[string]interface{}{test.attr: test.patched}},
+			}); err != nil {
+				t.Fatalf("Patch: %v", err)
+			}
+			if got := mustGet(t, test.h, created.ID); got.Attributes[test.attr] != test.patched {
+				t.Errorf("Patch: got %s %v, want %s", test.attr, got.Attributes[test.attr], test.patched)
+			}
+
+			page, err := test.h.GetAll(r, scim.ListRequestParams{Count: 10, StartIndex: 1})
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if page.TotalResults != 1 || page.Resources[0].ID != created.ID {
+				t.Errorf("GetAll: got %+v, want the created resource", page)
+			}
+
+			if err := test.h.Delete(r, created.ID); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := test.h.Get(r, created.ID); err == nil {
+				t.Errorf("Get after Delete: got no error")
+			}
+		})
+	}
+}
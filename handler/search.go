@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/elimity-com/scim/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// searchSuffix is the path suffix of a search request, e.g. `/Users/.search`.
+const searchSuffix = "/.search"
+
+type searchRequest struct {
+	Schemas            []string `json:"schemas"`
+	Attributes         []string `json:"attributes"`
+	ExcludedAttributes []string `json:"excludedAttributes"`
+	Filter             string   `json:"filter"`
+	SortBy             string   `json:"sortBy"`
+	SortOrder          string   `json:"sortOrder"`
+	StartIndex         int      `json:"startIndex"`
+	Count              *int     `json:"count"`
+}
+
+// SearchHandler serves POST searches, see RFC 7644 section 3.4.3, by passing the search request to the server as the
+// equivalent GET list request, e.g. `POST /Users/.search` with a filter as `GET /Users?filter=...`.
+type SearchHandler struct {
+	// server serves the list requests, paths are relative to it, e.g. `/Users`
+	server http.Handler
+	logger *logrus.Logger
+}
+
+func NewSearchHandler(l *logrus.Logger, server http.Handler) SearchHandler {
+	return SearchHandler{
+		server: server,
+		logger: l,
+	}
+}
+
+func (h SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var search searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+		RequestLogger(h.logger, r).Errorf("Failed to decode search request: %v", err)
+		WriteError(w, errors.ScimErrorInvalidSyntax)
+		return
+	}
+
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("filter", search.Filter)
+	set("attributes", strings.Join(search.Attributes, ","))
+	set("excludedAttributes", strings.Join(search.ExcludedAttributes, ","))
+	set("sortBy", search.SortBy)
+	set("sortOrder", search.SortOrder)
+	if search.StartIndex != 0 {
+		query.Set("startIndex", strconv.Itoa(search.StartIndex))
+	}
+	if search.Count != nil {
+		query.Set("count", strconv.Itoa(*search.Count))
+	}
+
+	list := r.Clone(r.Context())
+	list.Method = http.MethodGet
+	list.Body = http.NoBody
+	list.ContentLength = 0
+	list.URL.Path = strings.TrimSuffix(r.URL.Path, searchSuffix)
+	list.URL.RawPath = ""
+	list.URL.RawQuery = query.Encode()
+	RequestLogger(h.logger, r).Infof("Searching %s with %q", list.URL.Path, list.URL.RawQuery)
+	h.server.ServeHTTP(w, list)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	users := newTestUserHandler()
+	server := newTestServer(t, users, newTestGroupHandler())
+	search := NewSearchHandler(testLogger(), server)
+	createUsers(t, users, 5)
+
+	tests := []struct {
+		name      string
+		query     url.Values
+		body      string
+		wantTotal string
+	}{
+		{
+			name:      "filter",
+			query:     url.Values{"filter": {`userName sw "user0" and not (userName eq "user02")`}},
+			body:      `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:SearchRequest"], "filter": "userName sw \"user0\" and not (userName eq \"user02\")"}`,
+			wantTotal: "4",
+		},
+		{
+			name: "sorted page with attributes",
+			query: url.Values{
+				"filter":     {`userName pr`},
+				"sortBy":     {"userName"},
+				"sortOrder":  {"descending"},
+				"startIndex": {"2"},
+				"count":      {"2"},
+				"attributes": {"userName"},
+			},
+			body:      `{"filter": "userName pr", "sortBy": "userName", "sortOrder": "descending", "startIndex": 2, "count": 2, "attributes": ["userName"]}`,
+			wantTotal: "5",
+		},
+		{
+			name:      "count 0",
+			query:     url.Values{"count": {"0"}},
+			body:      `{"count": 0}`,
+			wantTotal: "5",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			get := serve(server, http.MethodGet, "/Users?"+test.query.Encode(), "")
+			if get.Code != http.StatusOK {
+				t.Fatalf("GET: got status %d, want %d: %s", get.Code, http.StatusOK, get.Body.String())
+			}
+			post := serve(search, http.MethodPost, "/Users/.search", test.body)
+			if post.Code != http.StatusOK {
+				t.Fatalf("POST: got status %d, want %d: %s", post.Code, http.StatusOK, post.Body.String())
+			}
+			got, want := decodeBody(t, post), decodeBody(t, get)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want the GET result %v", got, want)
+			}
+			if total := fmt.Sprint(got["totalResults"]); total != test.wantTotal {
+				t.Errorf("got %s results, want %s", total, test.wantTotal)
+			}
+		})
+	}
+
+	w := serve(search, http.MethodPost, "/Users/.search", `{"filter": `)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed search: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
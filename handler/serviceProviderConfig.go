@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ServiceProviderCapabilities advertises the capabilities the library always reports as unsupported in the service
+// provider config served by next: entity tags and sorting, which the resource handlers implement, and bulk operations,
+// served by BulkHandler, if bulk is set.
+func ServiceProviderCapabilities(bulk bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || strings.TrimSuffix(r.URL.Path, "/") != "/ServiceProviderConfig" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, r)
+
+		body := rec.body.Bytes()
+		if rec.status == http.StatusOK {
+			if b, err := withCapabilities(body, bulk); err == nil {
+				body = b
+			}
+		}
+		rec.writeTo(w, body)
+	})
+}
+
+// withCapabilities sets the capabilities of the service provider config in body.
+func withCapabilities(body []byte, bulk bool) ([]byte, error) {
+	var config map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&config); err != nil {
+		return nil, err
+	}
+
+	config["etag"] = map[string]interface{}{"supported": true}
+	config["sort"] = map[string]interface{}{"supported": true}
+	config["bulk"] = map[string]interface{}{
+		"supported":      bulk,
+		"maxOperations":  maxBulkOperations,
+		"maxPayloadSize": maxBulkPayloadSize,
+	}
+	return json.Marshal(config)
+}
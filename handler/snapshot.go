@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+)
+
+// snapshot returns all resources of s, ordered by id.
+func snapshot(s Store) ([]scim.Resource, error) {
+	records, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]scim.Resource, 0, len(records))
+	for _, record := range records {
+		resources = append(resources, snapshotResource(record))
+	}
+	sortResources(resources, "", "")
+	return resources, nil
+}
+
+// walkResources calls fn with each resource of s, in no particular order, without holding all of them in memory if s
+// is a WalkStore.
+func walkResources(s Store, fn func(resource scim.Resource) error) error {
+	return walk(s, func(record Record) error {
+		return fn(snapshotResource(record))
+	})
+}
+
+// snapshotResource returns the resource of record with its stored attributes and meta.
+func snapshotResource(record Record) scim.Resource {
+	created, _ := time.ParseInLocation(time.RFC3339, record.Meta["created"], time.UTC)
+	lastModified, _ := time.ParseInLocation(time.RFC3339, record.Meta["lastModified"], time.UTC)
+	return scim.Resource{
+		ID:         record.ID,
+		ExternalID: externalID(record.Attributes),
+		Attributes: record.Attributes,
+		Meta: scim.Meta{
+			Created:      &created,
+			LastModified: &lastModified,
+			Version:      record.Meta["version"],
+		},
+	}
+}
+
+// restore stores resources in s, overwriting resources with the same id. Resources without an id get a new one from
+// ids, missing meta is set as if the resource was created now. prepare is called with the id and attributes of each
+// resource before it is stored, e.g. to validate them and hash the password, if it returns an error the resource isn't
+// stored.
+func restore(s Store, ids IDGenerator, resources []scim.Resource, now time.Time, prepare func(id string, attributes scim.ResourceAttributes) error) error {
+	for _, resource := range resources {
+		id := resource.ID
+		if id == "" {
+			id = ids.NewID()
+		}
+		created, lastModified := now, now
+		if resource.Meta.Created != nil {
+			created = *resource.Meta.Created
+		}
+		if resource.Meta.LastModified != nil {
+			lastModified = *resource.Meta.LastModified
+		}
+		// the version may have been read as an entity tag
+		version := opaqueTag(resource.Meta.Version)
+		if version == "" {
+			version = nextVersion("")
+		}
+
+		attributes := resource.Attributes
+		if attributes == nil {
+			attributes = scim.ResourceAttributes{}
+		}
+		if resource.ExternalID.Present() {
+			attributes["externalId"] = resource.ExternalID.Value()
+		}
+		if err := prepare(id, attributes); err != nil {
+			return fmt.Errorf("resource %s: %w", id, err)
+		}
+
+		err := s.Put(Record{
+			ID:         id,
+			Attributes: attributes,
+			Meta: map[string]string{
+				"created":      created.Format(time.RFC3339),
+				"lastModified": lastModified.Format(time.RFC3339),
+				"version":      version,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undelete restores the deleted resource with the given id of s if it keeps deleted resources. check is called with
+// the attributes of the deleted resource to verify it can be restored, e.g. its unique attributes are not taken.
+func undelete(s Store, id string, check func(attributes scim.ResourceAttributes) error) error {
+	us, ok := s.(UndeleteStore)
+	if !ok {
+		return errors.ScimError{
+			Detail: "Deleted resources are not kept, soft delete is disabled.",
+			Status: http.StatusNotImplemented,
+		}
+	}
+
+	_, err := us.Undelete(id, func(record Record) error {
+		return check(record.Attributes)
+	})
+	switch err {
+	case ErrNotFound:
+		return errors.ScimErrorResourceNotFound(id)
+	case ErrExists:
+		return errors.ScimError{
+			ScimType: errors.ScimTypeUniqueness,
+			Detail:   fmt.Sprintf("Resource %s exists and can't be undeleted.", id),
+			Status:   http.StatusConflict,
+		}
+	}
+	return err
+}
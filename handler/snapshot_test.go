@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/elimity-com/scim"
+)
+
+func TestRestoreSeed(t *testing.T) {
+	const seed = `[
+		{"id": "1", "userName": "bjensen", "password": "t1meMa$heen"},
+		{"id": "2", "userName": "jsmith", "emails": [{"value": "jsmith@example.com", "type": "work"}]}
+	]`
+	var values []map[string]interface{}
+	if err := json.Unmarshal([]byte(seed), &values); err != nil {
+		t.Fatalf("failed to decode seed: %v", err)
+	}
+	resources := make([]scim.Resource, 0, len(values))
+	for _, value := range values {
+		id, _ := value["id"].(string)
+		delete(value, "id")
+		resources = append(resources, scim.Resource{ID: id, Attributes: value})
+	}
+
+	h := newTestUserHandler()
+	if err := h.Restore(resources); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	page, err := h.GetAll(testRequest(), scim.ListRequestParams{Count: 100, StartIndex: 1})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if page.TotalResults != 2 {
+		t.Fatalf("got %d results, want 2", page.TotalResults)
+	}
+	var ids, userNames []string
+	for _, resource := range page.Resources {
+		ids = append(ids, resource.ID)
+		userNames = append(userNames, resource.Attributes["userName"].(string))
+		if _, ok := resource.Attributes["password"]; ok {
+			t.Errorf("user %s: got the password, want it never returned", resource.ID)
+		}
+		got := mustGet(t, h, resource.ID)
+		if got.Meta.Created == nil || got.Meta.LastModified == nil || got.Meta.Version == "" {
+			t.Errorf("user %s: got meta %+v, want it set on restore", resource.ID, got.Meta)
+		}
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got ids %v, want %v", ids, want)
+	}
+	if want := []string{"bjensen", "jsmith"}; !reflect.DeepEqual(userNames, want) {
+		t.Errorf("got user names %v, want %v", userNames, want)
+	}
+}
+
+func TestRestoreRejectsDuplicate(t *testing.T) {
+	h := newTestUserHandler()
+	err := h.Restore([]scim.Resource{
+		{ID: "1", Attributes: scim.ResourceAttributes{"userName": "bjensen"}},
+		{ID: "2", Attributes: scim.ResourceAttributes{"userName": "BJensen"}},
+	})
+	if err == nil {
+		t.Fatal("Restore: got no error, want a uniqueness error")
+	}
+}
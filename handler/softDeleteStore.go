@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// ErrExists is returned by an UndeleteStore when a deleted record can't be restored because its id is in use.
+var ErrExists = errors.New("record already exists")
+
+// UndeleteStore is a Store that keeps deleted records so they can be restored.
+type UndeleteStore interface {
+	Store
+	// Undelete restores the deleted record with the given id and returns it. fn is called with the deleted record
+	// first, if it returns an error the record stays deleted. Returns ErrNotFound if there is no deleted record with
+	// the id and ErrExists if a record with the id exists.
+	Undelete(id string, fn func(record Record) error) (Record, error)
+}
+
+// Verify softDeleteStore is of type UndeleteStore, FilterStore, WalkStore and CountStore
+var _ UndeleteStore = &softDeleteStore{}
+var _ FilterStore = &softDeleteStore{}
+var _ WalkStore = &softDeleteStore{}
+var _ CountStore = &softDeleteStore{}
+
+// softDeleteStore moves deleted records to a store of tombstones instead of removing them. The lastModified of a
+// tombstone is the time it was deleted.
+type softDeleteStore struct {
+	Store
+	// mu serializes deletes and undeletes, so a record is never in both stores or in neither while it is moved
+	mu         sync.Mutex
+	tombstones Store
+	// clock tells the time records are deleted and restored at
+	clock Clock
+}
+
+// NewSoftDeleteStore returns an UndeleteStore keeping the records of s and the tombstones of deleted records in
+// tombstones, c tells the time of their deletion.
+func NewSoftDeleteStore(s, tombstones Store, c Clock) UndeleteStore {
+	return &softDeleteStore{
+		Store:      s,
+		tombstones: tombstones,
+		clock:      c,
+	}
+}
+
+func (s *softDeleteStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.Store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	record.Meta["lastModified"] = s.clock.Now().UTC().Truncate(time.Second).Format(time.RFC3339)
+	if err := s.tombstones.Put(record); err != nil {
+		return err
+	}
+	return s.Store.Delete(id)
+}
+
+func (s *softDeleteStore) DeleteAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.tombstones.DeleteAll(); err != nil {
+		return err
+	}
+	return s.Store.DeleteAll()
+}
+
+func (s *softDeleteStore) Undelete(id string, fn func(record Record) error) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.tombstones.Get(id)
+	if err != nil {
+		return Record{}, err
+	}
+	if _, err := s.Store.Get(id); err != ErrNotFound {
+		if err == nil {
+			return Record{}, ErrExists
+		}
+		return Record{}, err
+	}
+	if err := fn(record); err != nil {
+		return Record{}, err
+	}
+
+	// restoring modifies the resource, clients caching the deleted version must not match it
+	record.Meta["lastModified"] = s.clock.Now().UTC().Truncate(time.Second).Format(time.RFC3339)
+	record.Meta["version"] = nextVersion(record.Meta["version"])
+	if err := s.Store.Put(record); err != nil {
+		return Record{}, err
+	}
+	return record, s.tombstones.Delete(id)
+}
+
+// ListMatching lets the wrapped store narrow down the records matching expr if it can.
+func (s *softDeleteStore) ListMatching(expr filter.Expression) ([]Record, error) {
+	return listMatching(s.Store, expr)
+}
+
+// Walk lets the wrapped store pass its records one at a time if it can.
+func (s *softDeleteStore) Walk(fn func(record Record) error) error {
+	return walk(s.Store, fn)
+}
+
+// Count lets the wrapped store count its records if it can, tombstones aren't counted.
+func (s *softDeleteStore) Count() (int, error) {
+	return Count(s.Store)
+}
+
+func (s *softDeleteStore) Ping() error {
+	if err := s.tombstones.Ping(); err != nil {
+		return err
+	}
+	return s.Store.Ping()
+}
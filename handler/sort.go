@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+const sortOrderDescending = "descending"
+
+// sortResources orders resources by the sortBy attribute, falling back to the id. Resources missing the attribute
+// sort as the least value. The order is ascending unless sortOrder is "descending".
+func sortResources(resources []scim.Resource, sortBy, sortOrder string) {
+	descending := strings.EqualFold(sortOrder, sortOrderDescending)
+	sort.SliceStable(resources, func(i, j int) bool {
+		c := 0
+		if sortBy != "" {
+			a, _ := filter.Lookup(resources[i].Attributes, sortBy)
+			b, _ := filter.Lookup(resources[j].Attributes, sortBy)
+			c = compareSortValues(a, b)
+		}
+		if c == 0 {
+			c = strings.Compare(resources[i].ID, resources[j].ID)
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareSortValues compares strings (case-insensitive), booleans and numbers, nil is the least value.
+func compareSortValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0
+			case !a:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	if x, ok := sortNumber(a); ok {
+		if y, ok := sortNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func sortNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elimity-com/scim"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Verify sqliteStore is of type WalkStore and CountStore
+var _ WalkStore = &sqliteStore{}
+var _ CountStore = &sqliteStore{}
+
+// sqliteStore persists records in a SQLite table. The attributes are stored as a JSON column, the meta and the
+// externalId as columns of their own so they can be indexed.
+type sqliteStore struct {
+	db    *sql.DB
+	table string
+}
+
+// OpenSQLite opens (or creates) the SQLite database at the given path.
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, serialize access instead of failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// NewSQLiteStore returns a Store backed by the given table of db, the table is created if it does not exist.
+func NewSQLiteStore(db *sql.DB, table string) (Store, error) {
+	_, err := db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			id            TEXT PRIMARY KEY,
+			external_id   TEXT,
+			created       TEXT NOT NULL,
+			last_modified TEXT NOT NULL,
+			version       TEXT NOT NULL,
+			attributes    TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS %[1]s_external_id ON %[1]s (external_id);
+	`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+
+	return &sqliteStore{
+		db:    db,
+		table: table,
+	}, nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *sqliteStore) columns() string {
+	return "id, created, last_modified, version, attributes"
+}
+
+func (s *sqliteStore) scan(row rowScanner) (Record, error) {
+	var (
+		record                         Record
+		created, lastModified, version string
+		attributes                     []byte
+	)
+	if err := row.Scan(&record.ID, &created, &lastModified, &version, &attributes); err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, ErrNotFound
+		}
+		return Record{}, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(attributes))
+	d.UseNumber()
+	if err := d.Decode(&record.Attributes); err != nil {
+		return Record{}, fmt.Errorf("failed to decode attributes of %s: %w", record.ID, err)
+	}
+	record.Meta = map[string]string{
+		"created":      created,
+		"lastModified": lastModified,
+		"version":      version,
+	}
+	return record, nil
+}
+
+func (s *sqliteStore) Get(id string) (Record, error) {
+	row := s.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", s.columns(), s.table), id)
+	return s.scan(row)
+}
+
+func (s *sqliteStore) List() ([]Record, error) {
+	records := make([]Record, 0)
+	err := s.Walk(func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Walk scans the records row by row, the query stays open until fn returned for the last record.
+func (s *sqliteStore) Walk(fn func(record Record) error) error {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s FROM %s", s.columns(), s.table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := s.scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Count counts the rows of the table without reading them.
+func (s *sqliteStore) Count() (int, error) {
+	var n int
+	if err := s.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *sqliteStore) put(e execer, record Record) error {
+	attributes, err := json.Marshal(record.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes of %s: %w", record.ID, err)
+	}
+
+	var eID interface{}
+	if externalID := externalID(record.Attributes); externalID.Present() {
+		eID = externalID.Value()
+	}
+
+	_, err = e.Exec(fmt.Sprintf(`
+		INSERT INTO %s (id, external_id, created, last_modified, version, attributes) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			external_id = excluded.external_id,
+			created = excluded.created,
+			last_modified = excluded.last_modified,
+			version = excluded.version,
+			attributes = excluded.attributes
+	`, s.table), record.ID, eID, record.Meta["created"], record.Meta["lastModified"], record.Meta["version"], attributes)
+	return err
+}
+
+func (s *sqliteStore) Put(record Record) error {
+	return s.put(s.db, record)
+}
+
+func (s *sqliteStore) Delete(id string) error {
+	result, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) DeleteAll() error {
+	_, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s", s.table))
+	return err
+}
+
+func (s *sqliteStore) Patch(id string, fn func(record *Record) error) (Record, error) {
+	return s.PatchWithVersion(id, "", fn)
+}
+
+func (s *sqliteStore) PatchWithVersion(id, expectedVersion string, fn func(record *Record) error) (Record, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Record{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	record, err := s.scan(tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", s.columns(), s.table), id))
+	if err != nil {
+		return Record{}, err
+	}
+	if record.Attributes == nil {
+		record.Attributes = scim.ResourceAttributes{}
+	}
+	version := record.Meta["version"]
+	if !versionMatches(expectedVersion, version) {
+		return Record{}, ErrVersionMismatch
+	}
+
+	if err := fn(&record); err != nil {
+		return Record{}, err
+	}
+	if err := s.update(tx, record, version); err != nil {
+		return Record{}, err
+	}
+	return record, tx.Commit()
+}
+
+// update overwrites the stored record if its version is still version, otherwise it returns ErrVersionMismatch.
+func (s *sqliteStore) update(e execer, record Record, version string) error {
+	attributes, err := json.Marshal(record.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes of %s: %w", record.ID, err)
+	}
+
+	var eID interface{}
+	if externalID := externalID(record.Attributes); externalID.Present() {
+		eID = externalID.Value()
+	}
+
+	result, err := e.Exec(fmt.Sprintf(`
+		UPDATE %s SET external_id = ?, created = ?, last_modified = ?, version = ?, attributes = ?
+		WHERE id = ? AND version = ?
+	`, s.table), eID, record.Meta["created"], record.Meta["lastModified"], record.Meta["version"], attributes, record.ID, version)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+func (s *sqliteStore) Ping() error {
+	return s.db.Ping()
+}
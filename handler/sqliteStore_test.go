@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/elimity-com/scim"
+)
+
+// newTestSQLiteStore returns a store of the users table of a new SQLite database.
+func newTestSQLiteStore(t *testing.T) Store {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	s, err := NewSQLiteStore(db, "users")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, newTestSQLiteStore(t))
+}
+
+func TestSQLiteStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	r := testRequest()
+
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	s, err := NewSQLiteStore(db, "users")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	h := NewSchemaResourceHandler(testLogger(), "User", s, testUserSchema(), 100)
+	ids := make(map[string]string)
+	for _, userName := range []string{"bjensen", "jsmith"} {
+		resource, err := h.Create(r, scim.ResourceAttributes{
+			"userName": userName,
+			"emails":   []interface{}{map[string]interface{}{"value": userName + "@example.com", "type": "work"}},
+		})
+		if err != nil {
+			t.Fatalf("Create %s: %v", userName, err)
+		}
+		ids[userName] = resource.ID
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite after closing: %v", err)
+	}
+	defer db.Close()
+	s, err = NewSQLiteStore(db, "users")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore after closing: %v", err)
+	}
+	h = NewSchemaResourceHandler(testLogger(), "User", s, testUserSchema(), 100)
+	for userName, id := range ids {
+		resource, err := h.Get(r, id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", userName, err)
+		}
+		if resource.Attributes["userName"] != userName {
+			t.Errorf("got userName %v, want %s", resource.Attributes["userName"], userName)
+		}
+		emails, _ := resource.Attributes["emails"].([]interface{})
+		if len(emails) != 1 || emails[0].(map[string]interface{})["value"] != userName+"@example.com" {
+			t.Errorf("got emails %v of %s", resource.Attributes["emails"], userName)
+		}
+		if resource.Meta.Created == nil || resource.Meta.Created.IsZero() {
+			t.Errorf("got no created time of %s", userName)
+		}
+	}
+}
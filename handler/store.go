@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/elimity-com/scim"
+	"github.com/wilkermichael/scim-prototype/filter"
+)
+
+// ErrNotFound is returned by a Store when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrVersionMismatch is returned by Store.PatchWithVersion when the version of a record is not the expected one.
+var ErrVersionMismatch = errors.New("record version mismatch")
+
+// Record is a resource as persisted by a Store.
+type Record struct {
+	ID         string
+	Attributes scim.ResourceAttributes
+	// Meta holds the "created", "lastModified" and "version" of the resource.
+	Meta map[string]string
+}
+
+// Store persists the resources of a resource handler.
+type Store interface {
+	// Get returns the record with the given id or ErrNotFound.
+	Get(id string) (Record, error)
+	// List returns all records.
+	List() ([]Record, error)
+	// Put creates or overwrites the record with the id of the given record.
+	Put(record Record) error
+	// Delete removes the record with the given id or returns ErrNotFound.
+	Delete(id string) error
+	// DeleteAll removes all records.
+	DeleteAll() error
+	// Patch atomically updates the record with the given id using fn and returns the result. If fn returns an error
+	// the record is left unchanged. Returns ErrNotFound if the record does not exist.
+	Patch(id string, fn func(record *Record) error) (Record, error)
+	// PatchWithVersion is Patch if the version of the record matches expectedVersion, a comma separated list of entity
+	// tags as sent in If-Match, and returns ErrVersionMismatch otherwise. The version is compared and the record
+	// updated atomically, so a concurrent update in between is detected. An empty expectedVersion matches any version.
+	PatchWithVersion(id, expectedVersion string, fn func(record *Record) error) (Record, error)
+	// Ping returns an error if the store can't be reached.
+	Ping() error
+}
+
+// FilterStore is a Store that can narrow down the records matching a filter itself, e.g. in SQL.
+type FilterStore interface {
+	Store
+	// ListMatching returns a superset of the records matching expr, the caller still evaluates expr on each record.
+	ListMatching(expr filter.Expression) ([]Record, error)
+}
+
+// WalkStore is a Store that can pass its records to a function one at a time instead of loading all of them at once,
+// e.g. while reading the rows of a query.
+type WalkStore interface {
+	Store
+	// Walk calls fn with each record, in no particular order, until fn returns an error which Walk returns.
+	Walk(fn func(record Record) error) error
+}
+
+// CountStore is a Store that can count its records without reading them, e.g. with SELECT COUNT(*).
+type CountStore interface {
+	Store
+	// Count returns the number of records.
+	Count() (int, error)
+}
+
+// Count returns the number of records of s, counted by s if it is a CountStore, otherwise from List.
+func Count(s Store) (int, error) {
+	if cs, ok := s.(CountStore); ok {
+		return cs.Count()
+	}
+	records, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// walk calls fn with each record of s, one at a time if s is a WalkStore, otherwise from List.
+func walk(s Store, fn func(record Record) error) error {
+	if ws, ok := s.(WalkStore); ok {
+		return ws.Walk(fn)
+	}
+	records, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listMatching returns the records of s that may match expr, or all records if expr is nil.
+func listMatching(s Store, expr filter.Expression) ([]Record, error) {
+	if fs, ok := s.(FilterStore); ok && expr != nil {
+		return fs.ListMatching(expr)
+	}
+	return s.List()
+}
+
+// versionMatches reports whether version matches expectedVersion as described by Store.PatchWithVersion.
+func versionMatches(expectedVersion, version string) bool {
+	return expectedVersion == "" || etagMatches(expectedVersion, version)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/elimity-com/scim"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/wilkermichael/scim-prototype/handler"
+
+// Verify TracedResourceHandler is of type scim.ResourceHandler
+var _ scim.ResourceHandler = &TracedResourceHandler{}
+
+// TracedResourceHandler wraps a resource handler and records a span for every operation using the global tracer
+// provider, which does nothing unless one is configured.
+type TracedResourceHandler struct {
+	handler scim.ResourceHandler
+	// resourceType prefixes the span names, e.g. `User.Create`
+	resourceType string
+}
+
+func NewTracedResourceHandler(resourceType string, h scim.ResourceHandler) TracedResourceHandler {
+	return TracedResourceHandler{
+		handler:      h,
+		resourceType: resourceType,
+	}
+}
+
+// start starts the span of operation as a child of the span in the context of r and returns r carrying the new span.
+func (h TracedResourceHandler) start(r *http.Request, operation, id string) (*http.Request, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(r.Context(), h.resourceType+"."+operation, trace.WithAttributes(
+		attribute.String("scim.operation", operation),
+		attribute.String("scim.resource_type", h.resourceType),
+	))
+	if id != "" {
+		span.SetAttributes(attribute.String("scim.resource_id", id))
+	}
+	return r.WithContext(ctx), span
+}
+
+// end records err, if any, and ends the span.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (h TracedResourceHandler) Create(r *http.Request, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	r, span := h.start(r, "Create", "")
+	resource, err := h.handler.Create(r, attributes)
+	if err == nil {
+		span.SetAttributes(attribute.String("scim.resource_id", resource.ID))
+	}
+	end(span, err)
+	return resource, err
+}
+
+func (h TracedResourceHandler) Get(r *http.Request, id string) (scim.Resource, error) {
+	r, span := h.start(r, "Get", id)
+	resource, err := h.handler.Get(r, id)
+	end(span, err)
+	return resource, err
+}
+
+func (h TracedResourceHandler) GetAll(r *http.Request, params scim.ListRequestParams) (scim.Page, error) {
+	r, span := h.start(r, "GetAll", "")
+	page, err := h.handler.GetAll(r, params)
+	if err == nil {
+		span.SetAttributes(attribute.Int("scim.total_results", page.TotalResults))
+	}
+	end(span, err)
+	return page, err
+}
+
+func (h TracedResourceHandler) Replace(r *http.Request, id string, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	r, span := h.start(r, "Replace", id)
+	resource, err := h.handler.Replace(r, id, attributes)
+	end(span, err)
+	return resource, err
+}
+
+func (h TracedResourceHandler) Delete(r *http.Request, id string) error {
+	r, span := h.start(r, "Delete", id)
+	err := h.handler.Delete(r, id)
+	end(span, err)
+	return err
+}
+
+func (h TracedResourceHandler) Patch(r *http.Request, id string, operations []scim.PatchOperation) (scim.Resource, error) {
+	r, span := h.start(r, "Patch", id)
+	resource, err := h.handler.Patch(r, id, operations)
+	end(span, err)
+	return resource, err
+}
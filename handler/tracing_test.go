@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans makes the global tracer provider record spans in the returned exporter until the test ends.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestTracedCreate(t *testing.T) {
+	exporter := recordSpans(t)
+	h := NewTracedResourceHandler("User", newTestUserHandler())
+
+	resource, err := h.Create(testRequest(), scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := h.Create(testRequest(), scim.ResourceAttributes{}); err == nil {
+		t.Fatal("Create without userName: got no error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "User.Create" {
+		t.Errorf("got span %q, want User.Create", spans[0].Name)
+	}
+	attributes := make(map[attribute.Key]string)
+	for _, a := range spans[0].Attributes {
+		attributes[a.Key] = a.Value.Emit()
+	}
+	if attributes["scim.resource_id"] != resource.ID || attributes["scim.resource_type"] != "User" {
+		t.Errorf("got attributes %v", attributes)
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("got status %v of the failed create, want an error", spans[1].Status.Code)
+	}
+}
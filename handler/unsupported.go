@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+)
+
+// Operation is an operation of a resource handler.
+type Operation string
+
+const (
+	OperationCreate  Operation = "Create"
+	OperationGet     Operation = "Get"
+	OperationGetAll  Operation = "GetAll"
+	OperationReplace Operation = "Replace"
+	OperationPatch   Operation = "Patch"
+	OperationDelete  Operation = "Delete"
+)
+
+// WriteOperations are the operations modifying resources, a read-only directory supports none of them.
+var WriteOperations = []Operation{OperationCreate, OperationReplace, OperationPatch, OperationDelete}
+
+// NotImplemented returns the 501 SCIM error of an operation that is not supported for the resource type.
+func NotImplemented(resourceType string, operation Operation) errors.ScimError {
+	return errors.ScimError{
+		Detail: fmt.Sprintf("%s is not supported for %s resources.", operation, resourceType),
+		Status: http.StatusNotImplemented,
+	}
+}
+
+// Verify RestrictedResourceHandler is of type scim.ResourceHandler
+var _ scim.ResourceHandler = &RestrictedResourceHandler{}
+
+// RestrictedResourceHandler wraps a resource handler and rejects the operations it doesn't support with 501 Not
+// Implemented instead of calling it.
+type RestrictedResourceHandler struct {
+	handler      scim.ResourceHandler
+	resourceType string
+	unsupported  map[Operation]bool
+}
+
+func NewRestrictedResourceHandler(resourceType string, h scim.ResourceHandler, unsupported ...Operation) RestrictedResourceHandler {
+	ops := make(map[Operation]bool, len(unsupported))
+	for _, op := range unsupported {
+		ops[op] = true
+	}
+	return RestrictedResourceHandler{
+		handler:      h,
+		resourceType: resourceType,
+		unsupported:  ops,
+	}
+}
+
+// Supports reports whether the wrapped handler is called for operation.
+func (h RestrictedResourceHandler) Supports(operation Operation) bool {
+	return !h.unsupported[operation]
+}
+
+func (h RestrictedResourceHandler) Create(r *http.Request, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	if !h.Supports(OperationCreate) {
+		return scim.Resource{}, NotImplemented(h.resourceType, OperationCreate)
+	}
+	return h.handler.Create(r, attributes)
+}
+
+func (h RestrictedResourceHandler) Get(r *http.Request, id string) (scim.Resource, error) {
+	if !h.Supports(OperationGet) {
+		return scim.Resource{}, NotImplemented(h.resourceType, OperationGet)
+	}
+	return h.handler.Get(r, id)
+}
+
+func (h RestrictedResourceHandler) GetAll(r *http.Request, params scim.ListRequestParams) (scim.Page, error) {
+	if !h.Supports(OperationGetAll) {
+		return scim.Page{}, NotImplemented(h.resourceType, OperationGetAll)
+	}
+	return h.handler.GetAll(r, params)
+}
+
+func (h RestrictedResourceHandler) Replace(r *http.Request, id string, attributes scim.ResourceAttributes) (scim.Resource, error) {
+	if !h.Supports(OperationReplace) {
+		return scim.Resource{}, NotImplemented(h.resourceType, OperationReplace)
+	}
+	return h.handler.Replace(r, id, attributes)
+}
+
+func (h RestrictedResourceHandler) Patch(r *http.Request, id string, operations []scim.PatchOperation) (scim.Resource, error) {
+	if !h.Supports(OperationPatch) {
+		return scim.Resource{}, NotImplemented(h.resourceType, OperationPatch)
+	}
+	return h.handler.Patch(r, id, operations)
+}
+
+func (h RestrictedResourceHandler) Delete(r *http.Request, id string) error {
+	if !h.Supports(OperationDelete) {
+		return NotImplemented(h.resourceType, OperationDelete)
+	}
+	return h.handler.Delete(r, id)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+)
+
+func TestRestrictedResourceHandler(t *testing.T) {
+	users := newTestUserHandler()
+	existing, err := users.Create(testRequest(), scim.ResourceAttributes{"userName": "bjensen"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	h := NewRestrictedResourceHandler("User", users, WriteOperations...)
+	r := testRequest()
+
+	_, err = h.Create(r, scim.ResourceAttributes{"userName": "jsmith"})
+	scimErr, ok := err.(errors.ScimError)
+	if !ok || scimErr.Status != http.StatusNotImplemented {
+		t.Fatalf("Create: got error %v, want a 501 SCIM error", err)
+	}
+	if page, _ := users.GetAll(r, scim.ListRequestParams{Count: 10, StartIndex: 1}); page.TotalResults != 1 {
+		t.Errorf("got %d users, want the rejected create not stored", page.TotalResults)
+	}
+
+	if _, err := h.Get(r, existing.ID); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+	if err := h.Delete(r, existing.ID); err == nil || err.(errors.ScimError).Status != http.StatusNotImplemented {
+		t.Errorf("Delete: got error %v, want a 501 SCIM error", err)
+	}
+	if h.Supports(OperationCreate) || !h.Supports(OperationGetAll) {
+		t.Errorf("got Create supported %v and GetAll supported %v, want false and true", h.Supports(OperationCreate), h.Supports(OperationGetAll))
+	}
+}
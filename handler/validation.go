@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
+	"github.com/elimity-com/scim/schema"
+)
+
+// validateAttributes returns a single invalid value error listing every problem of attributes, e.g. a missing required
+// attribute and a value that is not canonical, so clients can fix them at once. InvalidAttributes reports them before
+// the library validates a request, this guards callers that bypass it, e.g. patches.
+func validateAttributes(s schema.Schema, attributes scim.ResourceAttributes) error {
+	if problems := attributeProblems(s, attributes); len(problems) > 0 {
+		return invalidAttributes(problems)
+	}
+	return nil
+}
+
+// InvalidAttributes returns a single invalid value error listing every problem of the attributes of a resource of rt,
+// including those of its schema extensions, and reports whether there is any. The library stops at the first problem
+// and reports it with a generic detail, so requests are checked before they reach it.
+func InvalidAttributes(rt scim.ResourceType, attributes map[string]interface{}) (errors.ScimError, bool) {
+	problems := attributeProblems(rt.Schema, attributes)
+	for _, extension := range rt.SchemaExtensions {
+		v := attributes[extension.Schema.ID]
+		if v == nil {
+			if extension.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", extension.Schema.ID))
+			}
+			continue
+		}
+		extensionAttributes, ok := v.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is not an object", extension.Schema.ID))
+			continue
+		}
+		for _, problem := range attributeProblems(extension.Schema, extensionAttributes) {
+			problems = append(problems, extension.Schema.ID+":"+problem)
+		}
+	}
+	if len(problems) == 0 {
+		return errors.ScimError{}, false
+	}
+	return invalidAttributes(problems), true
+}
+
+// invalidAttributes returns the invalid value error listing problems.
+func invalidAttributes(problems []string) errors.ScimError {
+	scimErr := errors.ScimErrorInvalidValue
+	scimErr.Detail = fmt.Sprintf("The resource is invalid: %s.", strings.Join(problems, "; "))
+	return scimErr
+}
+
+// attributeProblems describes every problem of attributes: missing required attributes, values the library rejects,
+// e.g. a number for a string, and values that are not canonical.
+func attributeProblems(s schema.Schema, attributes map[string]interface{}) []string {
+	var problems []string
+	for _, name := range missingRequired(s, attributes) {
+		problems = append(problems, fmt.Sprintf("%s is required", name))
+	}
+	for _, attr := range s.Attributes {
+		k, ok := attributeKey(attributes, attr.Name())
+		if !ok || attributes[k] == nil {
+			continue
+		}
+		// validated on its own, the library validates all attributes of a schema at once
+		single := schema.Schema{Attributes: schema.Attributes{attr}}
+		if _, scimErr := single.Validate(map[string]interface{}{attr.Name(): attributes[k]}); scimErr != nil {
+			problems = append(problems, fmt.Sprintf("%s is not a valid %s", attr.Name(), attributeType(attr)))
+		}
+	}
+	return append(problems, nonCanonicalValues(s.Attributes, attributes)...)
+}
+
+// attributeType describes the type of the values of attr, e.g. "string" or "list of complex values".
+func attributeType(attr schema.CoreAttribute) string {
+	if attr.MultiValued() {
+		return fmt.Sprintf("list of %s values", attr.AttributeType())
+	}
+	return attr.AttributeType() + " value"
+}
+
+// missingRequired returns the required attributes of s that are missing from attributes.
+func missingRequired(s schema.Schema, attributes map[string]interface{}) []string {
+	var missing []string
+	for _, attr := range s.Attributes {
+		if !attr.Required() {
+			continue
+		}
+		if k, ok := attributeKey(attributes, attr.Name()); !ok || attributes[k] == nil {
+			missing = append(missing, attr.Name())
+		}
+	}
+	return missing
+}
+
+// UnknownAttributes returns the attributes, including sub-attributes such as `name.givname`, that are not declared by
+// the schema or schema extensions of rt. The common attributes id, externalId, meta and schemas are always known.
+func UnknownAttributes(rt scim.ResourceType, attributes map[string]interface{}) []string {
+	var unknown []string
+	for k, v := range attributes {
+		switch strings.ToLower(k) {
+		case "id", "externalid", "meta", "schemas":
+			continue
+		}
+		if extension, ok := schemaExtension(rt, k); ok {
+			values, _ := v.(map[string]interface{})
+			for _, name := range unknownAttributes(extension.Attributes, values) {
+				unknown = append(unknown, k+":"+name)
+			}
+			continue
+		}
+		unknown = append(unknown, unknownAttributes(rt.Schema.Attributes, map[string]interface{}{k: v})...)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// SchemasMismatch returns the error of a resource of rt whose "schemas" attribute doesn't match its attributes and
+// true, see RFC 7643 section 3: it must list the schema of rt and the schema extensions whose attributes are present,
+// e.g. the enterprise User extension for a department, and no schemas rt doesn't have.
+func SchemasMismatch(rt scim.ResourceType, attributes map[string]interface{}) (errors.ScimError, bool) {
+	k, ok := attributeKey(attributes, "schemas")
+	if !ok {
+		return invalidSchemas("The schemas attribute is required."), true
+	}
+	values, ok := attributes[k].([]interface{})
+	if !ok {
+		return invalidSchemas("The schemas attribute must be an array of schema URIs."), true
+	}
+	declared := make([]string, 0, len(values))
+	for _, v := range values {
+		id, ok := v.(string)
+		if !ok {
+			return invalidSchemas("The schemas attribute must be an array of schema URIs."), true
+		}
+		if _, isExtension := schemaExtension(rt, id); !isExtension && !strings.EqualFold(id, rt.Schema.ID) {
+			return invalidSchemas(fmt.Sprintf("The schema %s is not a schema of %s resources.", id, rt.Name)), true
+		}
+		declared = append(declared, id)
+	}
+
+	if !containsFold(declared, rt.Schema.ID) {
+		return invalidSchemas(fmt.Sprintf("The schemas attribute must contain %s.", rt.Schema.ID)), true
+	}
+	for k := range attributes {
+		if _, ok := schemaExtension(rt, k); ok && !containsFold(declared, k) {
+			return invalidSchemas(fmt.Sprintf("The schemas attribute must contain %s, attributes of that extension are present.", k)), true
+		}
+	}
+	return errors.ScimError{}, false
+}
+
+// invalidSchemas returns the 400 SCIM error of a resource with a schemas attribute that doesn't match it.
+func invalidSchemas(detail string) errors.ScimError {
+	return errors.ScimError{
+		ScimType: errors.ScimTypeInvalidValue,
+		Detail:   detail,
+		Status:   http.StatusBadRequest,
+	}
+}
+
+// containsFold reports whether values contains s, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaExtension returns the schema extension of rt with the given id.
+func schemaExtension(rt scim.ResourceType, id string) (schema.Schema, bool) {
+	for _, extension := range rt.SchemaExtensions {
+		if strings.EqualFold(extension.Schema.ID, id) {
+			return extension.Schema, true
+		}
+	}
+	return schema.Schema{}, false
+}
+
+// unknownAttributes returns the attributes and sub-attributes of values that are not declared in attrs.
+func unknownAttributes(attrs schema.Attributes, values map[string]interface{}) []string {
+	var unknown []string
+	for k, v := range values {
+		attr, ok := attrs.ContainsAttribute(k)
+		if !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		if !attr.HasSubAttributes() {
+			continue
+		}
+
+		// a multi-valued complex attribute holds a list of sub-attribute maps
+		elements, ok := v.([]interface{})
+		if !ok {
+			elements = []interface{}{v}
+		}
+		seen := make(map[string]bool)
+		for _, e := range elements {
+			subValues, _ := e.(map[string]interface{})
+			for _, name := range unknownAttributes(attr.SubAttributes(), subValues) {
+				if !seen[name] {
+					seen[name] = true
+					unknown = append(unknown, k+"."+name)
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// nonCanonicalValues describes each value of a string attribute or sub-attribute of values that is not one of the
+// canonical values declared in attrs, such as an `emails.type` other than work, home or other. Attributes without
+// canonical values are free-form.
+func nonCanonicalValues(attrs schema.Attributes, values map[string]interface{}) []string {
+	var problems []string
+	for _, attr := range attrs {
+		k, ok := attributeKey(values, attr.Name())
+		if !ok {
+			continue
+		}
+
+		// a multi-valued attribute holds a list of values
+		elements, ok := values[k].([]interface{})
+		if !ok {
+			elements = []interface{}{values[k]}
+		}
+		for _, e := range elements {
+			if attr.HasSubAttributes() {
+				subValues, _ := e.(map[string]interface{})
+				for _, problem := range nonCanonicalValues(attr.SubAttributes(), subValues) {
+					problems = append(problems, attr.Name()+"."+problem)
+				}
+				continue
+			}
+			if value, ok := e.(string); ok && !isCanonical(attr.CanonicalValues(), value) {
+				problems = append(problems, fmt.Sprintf("%s %q is not one of %s", attr.Name(), value, strings.Join(attr.CanonicalValues(), ", ")))
+			}
+		}
+	}
+	return problems
+}
+
+// isCanonical reports whether value is one of canonicalValues, any value is if there are none.
+func isCanonical(canonicalValues []string, value string) bool {
+	if len(canonicalValues) == 0 {
+		return true
+	}
+	for _, c := range canonicalValues {
+		if strings.EqualFold(c, value) {
+			return true
+		}
+	}
+	return false
+}
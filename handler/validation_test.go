@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateMissingUserName(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	w := serve(server, http.MethodPost, "/Users", `{"nickName": "Babs"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if scimType := decodeBody(t, w)["scimType"]; scimType != "invalidValue" {
+		t.Errorf("got scimType %v, want invalidValue", scimType)
+	}
+	if total := decodeBody(t, serve(server, http.MethodGet, "/Users", ""))["totalResults"]; total != json.Number("0") {
+		t.Errorf("got %v users, want none", total)
+	}
+}
+
+func TestNonCanonicalEmailType(t *testing.T) {
+	server := newTestServer(t, newTestUserHandler(), newTestGroupHandler())
+
+	w := serve(server, http.MethodPost, "/Users", `{"userName": "bjensen", "emails": [{"value": "bjensen@example.com", "type": "invalid"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST: got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	body := decodeBody(t, w)
+	if body["scimType"] != "invalidValue" {
+		t.Errorf("POST: got scimType %v, want invalidValue", body["scimType"])
+	}
+	if detail, _ := body["detail"].(string); !strings.Contains(detail, `emails.type "invalid"`) {
+		t.Errorf("POST: got detail %q, want it to name emails.type", detail)
+	}
+
+	// canonical values are case insensitive
+	id := mustCreate(t, server, "/Users", `{"userName": "bjensen", "emails": [{"value": "bjensen@example.com", "type": "Work"}]}`)
+
+	w = serve(server, http.MethodPatch, "/Users/"+id, patchBody(`[{"op": "add", "path": "emails", "value": [{"value": "babs@jensen.org", "type": "invalid"}]}]`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PATCH: got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	w = serve(server, http.MethodPut, "/Users/"+id, `{"userName": "bjensen", "emails": [{"value": "bjensen@example.com", "type": "invalid"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT: got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
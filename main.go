@@ -2,57 +2,205 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/errors"
 	"github.com/elimity-com/scim/optional"
-	scimSchema "github.com/elimity-com/scim/schema"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/wilkermichael/scim-prototype/handler"
 )
 
 func main() {
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+
 	logger := logrus.New()
-	logger.SetLevel(logrus.DebugLevel)
-	logger.Formatter = &logrus.TextFormatter{
-		FullTimestamp: true,
+	if err := configureLogger(logger, cfg.LogLevel, cfg.LogFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		os.Exit(2)
 	}
 	logger.Info("Starting SCIM server")
 
+	shutdownTracing, err := configureTracing(cfg.Tracing)
+	if err != nil {
+		logger.Fatalf("Failed to configure tracing: %v", err)
+	}
+
+	router, closeStores, err := newServer(cfg, logger, prometheus.DefaultRegisterer)
+	if err != nil {
+		logger.Fatalf("Failed to set up SCIM server: %v", err)
+	}
+	defer closeStores()
+
+	// Start the server
+	httpServer := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: router,
+	}
+	if cfg.TLSCert != "" {
+		certs, err := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			logger.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		certs.reloadOnSIGHUP(logger)
+		httpServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+	listen := httpServer.ListenAndServe
+	if httpServer.TLSConfig != nil {
+		logger.Infof("SCIM server is running on %s with TLS, serving /scim/v2/", cfg.Addr)
+		// the certificate is served by GetCertificate
+		listen = func() error { return httpServer.ListenAndServeTLS("", "") }
+	} else {
+		logger.Infof("SCIM server is running on %s, serving /scim/v2/", cfg.Addr)
+	}
+
+	// Drain in-flight requests on SIGINT/SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	serveErr := serve(logger, httpServer, listen, stop, cfg.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Errorf("Failed to flush traces: %v", err)
+	}
+	if serveErr != nil {
+		logger.Fatal(serveErr)
+	}
+}
+
+// serve runs httpServer with listen until a signal is received on stop, then shuts it down waiting up to timeout for
+// in-flight requests to complete. It returns the error of listen if the server fails before, or of the shutdown if
+// requests are still in flight after timeout.
+func serve(logger *logrus.Logger, httpServer *http.Server, listen func() error, stop <-chan os.Signal, timeout time.Duration) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- listen()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("failed to start SCIM server: %w", err)
+	case sig := <-stop:
+		logger.Infof("Received %s, shutting down SCIM server", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to gracefully shut down SCIM server: %w", err)
+	}
+	logger.Info("SCIM server stopped")
+	return nil
+}
+
+// newServer sets up the stores, the SCIM server and the router for cfg and returns the handler serving all routes and a
+// function closing the stores. Metrics are registered with reg. The handler can be served by an httptest.Server to
+// exercise the routing and middlewares end to end.
+func newServer(cfg Config, logger *logrus.Logger, reg prometheus.Registerer) (http.Handler, func() error, error) {
 	// Create a service provider configuration
-	config := scim.ServiceProviderConfig{}
-
-	// Create user schema
-	s := scimSchema.Schema{
-		ID:          scimSchema.UserSchema,
-		Name:        optional.NewString("User"),
-		Description: optional.NewString("User Account"),
-		Attributes: []scimSchema.CoreAttribute{
-			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
-				Name:       "userName",
-				Required:   true,
-				Uniqueness: scimSchema.AttributeUniquenessServer(),
-			})),
-			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
-				Description: optional.NewString("A String that is an identifier for the resource as defined by the provisioning client."),
-				Name:        "externalId",
-				Uniqueness:  scimSchema.AttributeUniquenessServer(),
-			})),
-			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
-				Name: "nickName",
-			})),
-			scimSchema.SimpleCoreAttribute(scimSchema.SimpleBooleanParams(scimSchema.BooleanParams{
-				Description: optional.NewString("A boolean denoting that the user is either active or disabled."),
-				Name:        "active",
-				Required:    false,
-			})),
+	// The library always advertises bulk, sort, etag and changePassword as unsupported, ServiceProviderCapabilities
+	// advertises the ones that are, /Bulk is served separately.
+	config := scim.ServiceProviderConfig{
+		AuthenticationSchemes: []scim.AuthenticationScheme{
+			{
+				Type:        scim.AuthenticationTypeOauthBearerToken,
+				Name:        "OAuth Bearer Token",
+				Description: "Authentication scheme using the OAuth Bearer Token Standard",
+				SpecURI:     optional.NewString("https://www.rfc-editor.org/info/rfc6750"),
+				Primary:     true,
+			},
 		},
+		MaxResults:       cfg.MaxResults,
+		SupportFiltering: true,
+		SupportPatch:     !cfg.ReadOnly,
+	}
+
+	tables := []string{"users", "groups"}
+	if cfg.SoftDelete {
+		// deleted resources are moved to tables of their own
+		tables = append(tables, "users_deleted", "groups_deleted")
+	}
+	stores, closeStores, err := newStores(cfg.Store, cfg.DBPath, cfg.DSN, tables...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create store: %w", err)
+	}
+	// close the stores if the server can't be set up
+	ok := false
+	defer func() {
+		if !ok {
+			_ = closeStores()
+		}
+	}()
+	userStore, groupStore := stores["users"], stores["groups"]
+	if cfg.Store != "postgres" {
+		// the indexes are kept in memory, they can't see writes of other replicas sharing a PostgreSQL database
+		if userStore, err = handler.NewAttributeIndex(userStore, "userName", "externalId"); err != nil {
+			return nil, nil, fmt.Errorf("failed to index users: %w", err)
+		}
+		if groupStore, err = handler.NewMembershipIndex(groupStore); err != nil {
+			return nil, nil, fmt.Errorf("failed to index group members: %w", err)
+		}
+	}
+	if cfg.SoftDelete {
+		userStore = handler.NewSoftDeleteStore(userStore, stores["users_deleted"], handler.SystemClock())
+		groupStore = handler.NewSoftDeleteStore(groupStore, stores["groups_deleted"], handler.SystemClock())
 	}
 
-	resourceHandler := handler.NewUserResourceHandler(logger)
+	handlerOpts := []handler.Option{handler.WithMaxPatchOperations(cfg.MaxPatchOps)}
+	if cfg.UpsertOnPut {
+		handlerOpts = append(handlerOpts, handler.WithUpsertOnPut())
+	}
+	if cfg.IdempotentDelete {
+		handlerOpts = append(handlerOpts, handler.WithIdempotentDelete())
+	}
+	if cfg.DefaultActive {
+		handlerOpts = append(handlerOpts, handler.WithDefaultActive())
+	}
+	if cfg.WeakETags {
+		handlerOpts = append(handlerOpts, handler.WithWeakETags())
+	}
+	var auditLog handler.AuditLog
+	if cfg.EnableAudit {
+		auditLog = handler.NewMemoryAuditLog()
+		handlerOpts = append(handlerOpts, handler.WithAuditLog(auditLog))
+	}
+	userOpts := append([]handler.Option{handler.WithSchemaExtensions(enterpriseUserSchema())}, handlerOpts...)
+	resourceHandler := handler.NewSchemaResourceHandler(logger, "User", userStore, userSchema(), cfg.MaxResults, userOpts...)
+	groupResourceHandler := handler.NewSchemaResourceHandler(logger, "Group", groupStore, groupSchema(), cfg.MaxResults, handlerOpts...)
+
+	if cfg.SeedPath != "" {
+		if err := seed(cfg.SeedPath, resourceHandler, groupResourceHandler); err != nil {
+			return nil, nil, fmt.Errorf("failed to seed resources: %w", err)
+		}
+		logger.Infof("Seeded resources from %s", cfg.SeedPath)
+	}
 
 	// Create Resource Types
 	resourceTypes := []scim.ResourceType{
@@ -61,11 +209,32 @@ func main() {
 			Name:        "User",
 			Endpoint:    "/Users",
 			Description: optional.NewString("User Account"),
-			Schema:      s,
-			Handler:     resourceHandler,
+			Schema:      userSchema(),
+			SchemaExtensions: []scim.SchemaExtension{
+				{Schema: enterpriseUserSchema()},
+			},
+			Handler: handler.NewTracedResourceHandler("User", resourceHandler),
+		},
+		{
+			ID:          optional.NewString("Group"),
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: optional.NewString("Group"),
+			Schema:      groupSchema(),
+			Handler:     handler.NewTracedResourceHandler("Group", groupResourceHandler),
 		},
 	}
 
+	if cfg.ReadOnly {
+		// the resources are managed elsewhere, e.g. seeded from a directory export
+		for i, rt := range resourceTypes {
+			resourceTypes[i].Handler = handler.NewRestrictedResourceHandler(rt.Name, rt.Handler, handler.WriteOperations...)
+		}
+	}
+	if err := validateResourceTypes(resourceTypes, userSchema(), groupSchema(), enterpriseUserSchema()); err != nil {
+		return nil, nil, fmt.Errorf("invalid resource types: %w", err)
+	}
+
 	// Create a new SCIM server
 	serverArgs := scim.ServerArgs{
 		ServiceProviderConfig: &config,
@@ -79,52 +248,830 @@ func main() {
 
 	server, err := scim.NewServer(&serverArgs, serverOpts...)
 	if err != nil {
-		logger.Fatalf("Failed to start SCIM server: %v", err)
+		return nil, nil, fmt.Errorf("failed to create SCIM server: %w", err)
 	}
 
 	r := mux.NewRouter()
-	m := middleware{logger: logger}
-	r.Use(m.loggingMiddleware)
-	r.PathPrefix("/scim/v2/").Handler(http.StripPrefix("/scim/v2", server))
+	m := middleware{
+		logger:           logger,
+		token:            cfg.Token,
+		tokenUser:        cfg.TokenUser,
+		corsOrigins:      splitList(cfg.CORSOrigins),
+		maxBodySize:      int64(cfg.MaxBodySize),
+		redactAttributes: splitList(cfg.RedactAttributes),
+		logResponses:     cfg.LogResponses,
+	}
 
-	// Start the server
-	logger.Info("SCIM server is running on http://localhost:8080/scim/v2/")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		logger.Fatalf("Failed to start SCIM server: %v", err)
+	// serves the SCIM API relative to /scim/v2, bulk operations are dispatched to it as well
+	var scimHandler http.Handler = handler.CommonAttributeFilters(handler.DiscoveryMeta(handler.ServiceProviderCapabilities(!cfg.ReadOnly, server)))
+	if cfg.BaseURL != "" {
+		scimHandler = handler.Locations(cfg.BaseURL, scimHandler)
+	}
+	scimHandler = handler.ConditionalGet(scimHandler)
+	// searches and bulk operations are dispatched to the SCIM handler, so their filters are checked as well
+	scimHandler = handler.MaxFilterLength(cfg.MaxFilterLength, scimHandler)
+	scimHandler = versionSegment(scimHandler)
+	// every problem of a resource is reported at once, after the more specific checks below
+	scimHandler = m.validationMiddleware(resourceTypes)(scimHandler)
+	if cfg.StrictAttributes {
+		scimHandler = m.strictAttributesMiddleware(resourceTypes)(scimHandler)
+	}
+	if cfg.CheckSchemas {
+		scimHandler = m.schemasMiddleware(resourceTypes)(scimHandler)
+	}
+	if m.token == "" {
+		logger.Warn("No bearer token configured, the SCIM API is unauthenticated")
+	}
+	promMetrics := newMetrics(reg, logger, map[string]handler.Store{"User": userStore, "Group": groupStore})
+	r.Use(m.requestIDMiddleware, m.traceMiddleware, promMetrics.middleware, m.bodyLimitMiddleware, m.loggingMiddleware)
+	r.HandleFunc("/healthz", healthz).Methods(http.MethodGet)
+	r.Handle("/metrics", metricsHandler(reg)).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", readyz(logger, userStore, groupStore)).Methods(http.MethodGet)
+	if cfg.EnableReset {
+		logger.Warn("Reset endpoint enabled, POST /admin/reset deletes all resources")
+		r.Handle("/admin/reset", m.authMiddleware(reset(logger, resourceHandler, groupResourceHandler))).Methods(http.MethodPost)
+	}
+	if cfg.EnableAudit {
+		r.Handle("/admin/audit", m.authMiddleware(audit(logger, auditLog))).Methods(http.MethodGet)
+	}
+	if cfg.EnableDump {
+		r.Handle("/admin/dump", m.authMiddleware(dump(logger, resourceTypes, map[string]walker{
+			"User":  resourceHandler,
+			"Group": groupResourceHandler,
+		}))).Methods(http.MethodGet)
+	}
+	if cfg.SoftDelete {
+		r.Handle("/admin/undelete/{resourceType}/{id}", m.authMiddleware(undelete(logger, map[string]undeleter{
+			"Users":  resourceHandler,
+			"Groups": groupResourceHandler,
+		}))).Methods(http.MethodPost)
+	}
+
+	// scimRoute wraps the handlers of the SCIM API
+	scimRoute := func(next http.Handler) http.Handler {
+		return m.authMiddleware(m.contentTypeMiddleware(m.jsonSyntaxMiddleware(next)))
+	}
+	if cfg.RateLimit > 0 {
+		limiter, err := newRateLimiter(logger, cfg.RateLimit, cfg.RateBurst, cfg.RateLimitBy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure rate limiting: %w", err)
+		}
+		unlimited := scimRoute
+		scimRoute = func(next http.Handler) http.Handler {
+			return limiter.middleware(unlimited(next))
+		}
+	}
+	r.Handle("/scim/v2/Bulk", scimRoute(handler.NewBulkHandler(logger, scimHandler, cfg.BulkConcurrency))).Methods(http.MethodPost)
+	r.Handle("/scim/v2/Me", scimRoute(me(scimHandler))).Methods(http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	r.Handle("/scim/v2/{resourceType}/.search", scimRoute(http.StripPrefix("/scim/v2", handler.NewSearchHandler(logger, scimHandler)))).Methods(http.MethodPost)
+	r.PathPrefix("/scim/v2/").Handler(scimRoute(http.StripPrefix("/scim/v2", scimHandler)))
+	r.NotFoundHandler = http.HandlerFunc(notFound)
+
+	// CORS wraps the router so preflight requests are answered before routing and authentication
+	router := m.corsMiddleware(r)
+	if cfg.Pretty {
+		// the admin endpoints are left as is, indenting buffers the response and a dump is streamed
+		plain, indented := router, handler.Indent(router)
+		router = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/admin/") {
+				plain.ServeHTTP(w, r)
+				return
+			}
+			indented.ServeHTTP(w, r)
+		})
+	}
+	ok = true
+	return router, closeStores, nil
+}
+
+// metricsHandler serves the metrics registered with reg, like promhttp.Handler does for the default registry.
+func metricsHandler(reg prometheus.Registerer) http.Handler {
+	gatherer := prometheus.DefaultGatherer
+	if g, ok := reg.(prometheus.Gatherer); ok {
+		gatherer = g
+	}
+	return promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+// configureLogger applies the level and format (text or json) to logger.
+func configureLogger(logger *logrus.Logger, level, format string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q, expected one of panic, fatal, error, warn, info, debug or trace", level)
+	}
+	logger.SetLevel(lvl)
+
+	switch format {
+	case "text":
+		logger.Formatter = &logrus.TextFormatter{
+			FullTimestamp: true,
+		}
+	case "json":
+		logger.Formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	return nil
+}
+
+// newStores creates a store for each of the given tables for the given store type.
+func newStores(storeType, dbPath, dsn string, tables ...string) (map[string]handler.Store, func() error, error) {
+	var (
+		newStore func(table string) (handler.Store, error)
+		closeDB  func() error
+	)
+	switch storeType {
+	case "memory":
+		newStore = func(string) (handler.Store, error) { return handler.NewMemoryStore(), nil }
+		closeDB = func() error { return nil }
+	case "sqlite":
+		db, err := handler.OpenSQLite(dbPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open SQLite database %s: %w", dbPath, err)
+		}
+		newStore = func(table string) (handler.Store, error) { return handler.NewSQLiteStore(db, table) }
+		closeDB = db.Close
+	case "postgres":
+		db, err := handler.OpenPostgres(dsn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+		}
+		newStore = func(table string) (handler.Store, error) { return handler.NewPostgresStore(db, table) }
+		closeDB = db.Close
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q, expected memory, sqlite or postgres", storeType)
+	}
+
+	stores := make(map[string]handler.Store, len(tables))
+	for _, table := range tables {
+		s, err := newStore(table)
+		if err != nil {
+			_ = closeDB()
+			return nil, nil, err
+		}
+		stores[table] = s
+	}
+	return stores, closeDB, nil
+}
+
+// notFound responds to requests no route matches. Clients of the SCIM API get a SCIM error, e.g. for `/scim/v2` or
+// `/scim/Users` with a misconfigured base URL.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/scim" && !strings.HasPrefix(r.URL.Path, "/scim/") {
+		http.NotFound(w, r)
+		return
+	}
+	handler.WriteError(w, errors.ScimError{
+		Detail: fmt.Sprintf("Unknown endpoint %s, the SCIM API is served under /scim/v2/.", r.URL.Path),
+		Status: http.StatusNotFound,
+	})
+}
+
+// versionSegment rejects requests to the SCIM API, relative to /scim/v2, whose path starts with a version segment
+// such as `/v2/Users` with a SCIM 404. Clients configured with a base URL that already ends in /v2 send them to
+// `/scim/v2/v2/Users`, which the library would otherwise serve as `/Users`.
+func versionSegment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if isVersion(segment) {
+			handler.WriteError(w, errors.ScimError{
+				Detail: fmt.Sprintf("Unexpected version segment %s after /scim/v2, the SCIM API is served under /scim/v2/ only, check the base URL.", segment),
+				Status: http.StatusNotFound,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isVersion reports whether segment is a version path segment, e.g. v2.
+func isVersion(segment string) bool {
+	if len(segment) < 2 || (segment[0] != 'v' && segment[0] != 'V') {
+		return false
+	}
+	for _, c := range segment[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// healthz reports that the process is alive.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyz reports whether the server can serve requests, i.e. all stores can be reached.
+func readyz(logger *logrus.Logger, stores ...handler.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		for _, s := range stores {
+			if err := s.Ping(); err != nil {
+				logger.Errorf("Readiness check failed: %v", err)
+				http.Error(w, "store unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+// resetter is implemented by the resource handlers that can delete all their resources.
+type resetter interface {
+	Reset(r *http.Request) error
+}
+
+// reset deletes all resources of the given handlers.
+func reset(logger *logrus.Logger, handlers ...resetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range handlers {
+			if err := h.Reset(r); err != nil {
+				handler.RequestLogger(logger, r).Errorf("Failed to reset resources: %v", err)
+				http.Error(w, "reset failed", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// audit writes the entries of the audit log as JSON, optionally only those of the resource with the id given by the
+// "id" query parameter.
+func audit(logger *logrus.Logger, auditLog handler.AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := auditLog.Entries()
+		if err != nil {
+			handler.RequestLogger(logger, r).Errorf("Failed to read the audit log: %v", err)
+			http.Error(w, "audit log unavailable", http.StatusInternalServerError)
+			return
+		}
+		if id := r.URL.Query().Get("id"); id != "" {
+			matching := make([]handler.AuditEntry, 0, len(entries))
+			for _, e := range entries {
+				if e.ID == id {
+					matching = append(matching, e)
+				}
+			}
+			entries = matching
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+	}
+}
+
+// walker is implemented by the resource handlers that can pass their resources to a function one at a time.
+type walker interface {
+	Walk(fn func(resource scim.Resource) error) error
+}
+
+// dump streams all resources as newline delimited JSON, one resource per line in its SCIM representation including id
+// and meta but without the attributes that are never returned, e.g. for backups. walkers maps the names of the resource
+// types to their handlers, the resources are read one at a time if the store can, so the whole dump is never held in
+// memory.
+func dump(logger *logrus.Logger, resourceTypes []scim.ResourceType, walkers map[string]walker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		e := json.NewEncoder(w)
+		written := false
+		for _, rt := range resourceTypes {
+			h, ok := walkers[rt.Name]
+			if !ok {
+				continue
+			}
+			err := h.Walk(func(resource scim.Resource) error {
+				written = true
+				return e.Encode(dumpResource(rt, resource))
+			})
+			if err != nil {
+				handler.RequestLogger(logger, r).Errorf("Failed to dump %s resources: %v", rt.Name, err)
+				if !written {
+					http.Error(w, "dump failed", http.StatusInternalServerError)
+				}
+				// the status was sent with the first line, the client sees a truncated dump
+				return
+			}
+		}
+	}
+}
+
+// dumpResource returns the SCIM representation of a resource of the resource type, as accepted by --seed.
+func dumpResource(rt scim.ResourceType, resource scim.Resource) map[string]interface{} {
+	schemas := []string{rt.Schema.ID}
+	for _, ext := range rt.SchemaExtensions {
+		if _, ok := resource.Attributes[ext.Schema.ID]; ok {
+			schemas = append(schemas, ext.Schema.ID)
+		}
+	}
+
+	representation := make(map[string]interface{}, len(resource.Attributes)+3)
+	for k, v := range resource.Attributes {
+		representation[k] = v
+	}
+	representation["schemas"] = schemas
+	representation["id"] = resource.ID
+	meta := map[string]interface{}{
+		"resourceType": rt.Name,
+		"version":      resource.Meta.Version,
+	}
+	if resource.Meta.Created != nil {
+		meta["created"] = resource.Meta.Created.Format(time.RFC3339)
+	}
+	if resource.Meta.LastModified != nil {
+		meta["lastModified"] = resource.Meta.LastModified.Format(time.RFC3339)
+	}
+	representation["meta"] = meta
+	return representation
+}
+
+// undeleter is implemented by the resource handlers that can restore deleted resources.
+type undeleter interface {
+	Undelete(r *http.Request, id string) error
+}
+
+// undelete restores a deleted resource of the resource type in the path, handlers maps the resource type endpoints to
+// their handlers.
+func undelete(logger *logrus.Logger, handlers map[string]undeleter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		h, ok := handlers[vars["resourceType"]]
+		if !ok {
+			handler.WriteError(w, errors.ScimError{
+				Detail: fmt.Sprintf("Unknown resource type %q.", vars["resourceType"]),
+				Status: http.StatusNotFound,
+			})
+			return
+		}
+
+		if err := h.Undelete(r, vars["id"]); err != nil {
+			scimErr, ok := err.(errors.ScimError)
+			if !ok {
+				handler.RequestLogger(logger, r).Errorf("Failed to undelete %s: %v", r.URL.Path, err)
+				scimErr = errors.ScimError{Status: http.StatusInternalServerError}
+			}
+			handler.WriteError(w, scimErr)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type restorer interface {
+	Restore(resources []scim.Resource) error
+}
+
+// seed loads the resources of the JSON file at path, which holds lists of Users and Groups in their SCIM
+// representation, e.g. `{"Users": [{"id": "2819c223", "userName": "bjensen"}], "Groups": []}`.
+func seed(path string, users, groups restorer) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Users  []map[string]interface{}
+		Groups []map[string]interface{}
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&file); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	if err := users.Restore(seedResources(file.Users)); err != nil {
+		return fmt.Errorf("failed to restore users: %w", err)
+	}
+	if err := groups.Restore(seedResources(file.Groups)); err != nil {
+		return fmt.Errorf("failed to restore groups: %w", err)
 	}
+	return nil
+}
+
+// seedResources converts SCIM resource representations to resources, keeping their id and meta.
+func seedResources(values []map[string]interface{}) []scim.Resource {
+	resources := make([]scim.Resource, 0, len(values))
+	for _, attributes := range values {
+		var resource scim.Resource
+		resource.ID, _ = attributes["id"].(string)
+		if meta, ok := attributes["meta"].(map[string]interface{}); ok {
+			if created, err := time.Parse(time.RFC3339, fmt.Sprint(meta["created"])); err == nil {
+				resource.Meta.Created = &created
+			}
+			if lastModified, err := time.Parse(time.RFC3339, fmt.Sprint(meta["lastModified"])); err == nil {
+				resource.Meta.LastModified = &lastModified
+			}
+			resource.Meta.Version, _ = meta["version"].(string)
+		}
+
+		delete(attributes, "id")
+		delete(attributes, "meta")
+		delete(attributes, "schemas")
+		resource.Attributes = attributes
+		resources = append(resources, resource)
+	}
+	return resources
 }
 
 type middleware struct {
 	logger *logrus.Logger
+	// token is the shared secret expected in the Authorization header, authentication is disabled when empty.
+	token string
+	// tokenUser is the id of the user authenticated by token, if any.
+	tokenUser string
+	// corsOrigins are the origins allowed to make cross-origin requests, CORS is disabled when empty.
+	corsOrigins []string
+	// maxBodySize is the maximum size of request bodies in bytes.
+	maxBodySize int64
+	// redactAttributes are the attributes whose values are masked in logged request and response bodies.
+	redactAttributes []string
+	// logResponses logs response bodies at trace level.
+	logResponses bool
+}
+
+// splitList splits a comma separated flag value, ignoring empty elements.
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// corsMiddleware allows browsers on the configured origins to call the API and answers their preflight requests.
+func (m middleware) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !m.corsAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "Etag, Location, "+handler.RequestIDHeader)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, "+handler.RequestIDHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowed reports whether origin may make cross-origin requests.
+func (m middleware) corsAllowed(origin string) bool {
+	for _, allowed := range m.corsOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIDMiddleware reads the X-Request-ID header, or generates one, stores it in the request context and echoes it
+// on the response.
+func (m middleware) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(handler.RequestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		w.Header().Set(handler.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(handler.WithRequestID(r.Context(), id)))
+	})
+}
+
+// schemasMiddleware rejects creates and replaces of the given resource types whose schemas attribute doesn't match
+// their attributes, e.g. lacks the enterprise User extension for a department. The library ignores the schemas of
+// resources, so the request body is checked before it reaches the server.
+func (m middleware) schemasMiddleware(resourceTypes []scim.ResourceType) func(http.Handler) http.Handler {
+	return m.resourceBodyMiddleware(resourceTypes, handler.SchemasMismatch)
+}
+
+// validationMiddleware rejects creates and replaces of the given resource types with invalid attributes, listing every
+// problem at once. The library reports only the first problem it finds, so the request body is checked before it
+// reaches the server.
+func (m middleware) validationMiddleware(resourceTypes []scim.ResourceType) func(http.Handler) http.Handler {
+	return m.resourceBodyMiddleware(resourceTypes, handler.InvalidAttributes)
+}
+
+// resourceBodyMiddleware rejects creates and replaces of the given resource types for which check returns an error
+// with that error. Bodies that aren't JSON objects are left to the server.
+func (m middleware) resourceBodyMiddleware(resourceTypes []scim.ResourceType, check func(rt scim.ResourceType, attributes map[string]interface{}) (errors.ScimError, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rt := range resourceTypes {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == rt.Endpoint:
+				case r.Method == http.MethodPut && path.Dir(r.URL.Path) == rt.Endpoint:
+				default:
+					continue
+				}
+
+				b, ok := m.readBody(w, r)
+				if !ok {
+					return
+				}
+
+				var attributes map[string]interface{}
+				d := json.NewDecoder(bytes.NewReader(b))
+				d.UseNumber()
+				if err := d.Decode(&attributes); err != nil {
+					// leave the error response to the server
+					break
+				}
+				if scimErr, rejected := check(rt, attributes); rejected {
+					handler.RequestLogger(m.logger, r).Warnf("Rejecting %s %s: %s", r.Method, r.URL.Path, scimErr.Detail)
+					handler.WriteError(w, scimErr)
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// strictAttributesMiddleware rejects creates of the given resource types with attributes their schemas don't declare.
+// The library drops unknown attributes, so the request body is checked before it reaches the server.
+func (m middleware) strictAttributesMiddleware(resourceTypes []scim.ResourceType) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, rt := range resourceTypes {
+				if r.URL.Path != rt.Endpoint {
+					continue
+				}
+
+				b, ok := m.readBody(w, r)
+				if !ok {
+					return
+				}
+
+				var attributes map[string]interface{}
+				if err := json.Unmarshal(b, &attributes); err != nil {
+					// leave the error response to the server
+					break
+				}
+				if unknown := handler.UnknownAttributes(rt, attributes); len(unknown) > 0 {
+					handler.WriteError(w, errors.ScimError{
+						ScimType: errors.ScimTypeInvalidSyntax,
+						Detail:   fmt.Sprintf("Unknown attributes: %s.", strings.Join(unknown, ", ")),
+						Status:   http.StatusBadRequest,
+					})
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// contentTypeMiddleware rejects request bodies that are not JSON with 415 and responds with application/scim+json.
+func (m middleware) contentTypeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/scim+json")
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || (mediaType != "application/scim+json" && mediaType != "application/json") {
+				handler.RequestLogger(m.logger, r).Warnf("Unsupported content type %q: %s %s", r.Header.Get("Content-Type"), r.Method, r.URL.Path)
+				handler.WriteError(w, errors.ScimError{
+					Detail: "The request body must be application/scim+json or application/json.",
+					Status: http.StatusUnsupportedMediaType,
+				})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonSyntaxMiddleware rejects request bodies that are not valid JSON with an invalidSyntax error telling where the
+// body is malformed, the library responds with a generic detail.
+func (m middleware) jsonSyntaxMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		b, ok := m.readBody(w, r)
+		if !ok {
+			return
+		}
+
+		if !json.Valid(b) {
+			var v interface{}
+			err := json.Unmarshal(b, &v)
+			handler.RequestLogger(m.logger, r).Warnf("Malformed request body: %s %s: %v", r.Method, r.URL.Path, err)
+			handler.WriteError(w, errors.ScimError{
+				ScimType: errors.ScimTypeInvalidSyntax,
+				Detail:   jsonSyntaxDetail(err),
+				Status:   http.StatusBadRequest,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonSyntaxDetail describes the error of decoding a malformed request body.
+func jsonSyntaxDetail(err error) string {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		return fmt.Sprintf("The request body is not valid JSON: %v (at offset %d).", syntaxErr, syntaxErr.Offset)
+	}
+	return fmt.Sprintf("The request body is not valid JSON: %v.", err)
+}
+
+// serviceProviderConfigPath is the only path served without authentication.
+const serviceProviderConfigPath = "/scim/v2/ServiceProviderConfig"
+
+func (m middleware) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The service provider config is public so clients can discover the authentication scheme, no other path is
+		if m.token == "" || r.URL.Path == serviceProviderConfigPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(m.token)) != 1 {
+			handler.RequestLogger(m.logger, r).Warnf("Unauthorized request: %s %s", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			handler.WriteError(w, errors.ScimError{
+				Detail: "Missing or invalid bearer token.",
+				Status: http.StatusUnauthorized,
+			})
+			return
+		}
+
+		if m.tokenUser != "" {
+			r = r.WithContext(handler.WithPrincipal(r.Context(), m.tokenUser))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// me serves /Me as an alias of the resource of the authenticated user, see RFC 7644 section 3.11.
+func me(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := handler.Principal(r.Context())
+		if id == "" {
+			handler.WriteError(w, errors.ScimError{
+				Detail: "The authenticated client is not mapped to a user.",
+				Status: http.StatusNotFound,
+			})
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/Users/" + url.PathEscape(id)
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	}
+}
+
+// bodyLimitMiddleware rejects requests with a body larger than maxBodySize with 413. Bodies without a Content-Length
+// are cut off at the limit, reading more fails.
+func (m middleware) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > m.maxBodySize {
+			handler.RequestLogger(m.logger, r).Warnf("Request body of %d bytes exceeds the limit: %s %s", r.ContentLength, r.Method, r.URL.Path)
+			handler.WriteError(w, bodyTooLarge(m.maxBodySize))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, m.maxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBody reads the request body and replaces it with a copy so the next handler can read it again. If the body
+// can't be read it responds with an error, 413 if the body exceeds the limit, and returns false.
+func (m middleware) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		handler.RequestLogger(m.logger, r).Errorf("Failed to read request body: %v", err)
+		if maxBytesErr, ok := err.(*http.MaxBytesError); ok {
+			handler.WriteError(w, bodyTooLarge(maxBytesErr.Limit))
+		} else {
+			handler.WriteError(w, errors.ScimErrorInvalidSyntax)
+		}
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewBuffer(b))
+	return b, true
+}
+
+// bodyTooLarge returns the 413 SCIM error of a request body exceeding limit bytes.
+func bodyTooLarge(limit int64) errors.ScimError {
+	return errors.ScimError{
+		Detail: fmt.Sprintf("The request body exceeds the maximum size of %d bytes.", limit),
+		Status: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// maxLoggedResponse is the number of bytes of a response body that are logged, e.g. of a large list response.
+const maxLoggedResponse = 64 << 10
+
+// indentBody returns the request or response body b indented for logging with the values of the redacted attributes
+// masked if it is JSON, or as is otherwise.
+func indentBody(b []byte, redacted []string) string {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return string(b)
+	}
+	redact(v, redacted)
+
+	prettyJSON, err := json.MarshalIndent(v, "", " \t")
+	if err != nil {
+		return string(b)
+	}
+	return string(prettyJSON)
 }
 
 func (m middleware) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Log the request
-		m.logger.Printf("Received request: %s %s", r.Method, r.URL.Path)
+		logger := handler.RequestLogger(m.logger, r)
+		start := time.Now()
+		logger.Debugf("Received request: %s %s", r.Method, r.URL.Path)
 
-		// Read the body
-		if m.logger.Level == logrus.DebugLevel {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// Log the body, readBody restores it for the next handler whether or not it is JSON
+		bodyRead := true
+		if m.logger.IsLevelEnabled(logrus.DebugLevel) {
 			switch r.Method {
 			case http.MethodPost, http.MethodPatch, http.MethodPut:
-				b, err := io.ReadAll(r.Body)
-				if err != nil {
-					m.logger.Errorf("Failed to read request body: %v", err)
+				var b []byte
+				if b, bodyRead = m.readBody(rec, r); bodyRead {
+					logger.Debugf("Request body: \n%s", indentBody(b, m.redactAttributes))
 				}
+			}
+		}
 
-				var prettyJSON bytes.Buffer
-				err = json.Indent(&prettyJSON, b, "", " \t")
-				if err != nil {
-					m.logger.Errorf("Failed to indent request body: %v", err)
-				}
-				m.logger.Debugf("Request body: \n%s", prettyJSON.String())
+		if m.logResponses && m.logger.IsLevelEnabled(logrus.TraceLevel) {
+			rec.body = &bytes.Buffer{}
+		}
+
+		// Call the next handler, readBody responded if the body could not be read
+		if bodyRead {
+			next.ServeHTTP(rec, r)
+		}
 
-				// Replace read bytes
-				r.Body = io.NopCloser(bytes.NewBuffer(b))
+		if rec.body != nil && rec.body.Len() > 0 {
+			if rec.bytes > rec.body.Len() {
+				// a truncated body can't be decoded to redact it
+				logger.Tracef("Response body of %d bytes not logged, it exceeds %d bytes", rec.bytes, maxLoggedResponse)
+			} else {
+				logger.Tracef("Response body: \n%s", indentBody(rec.body.Bytes(), m.redactAttributes))
 			}
 		}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
+		// Log the response
+		logger.WithFields(logrus.Fields{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"status":   rec.status,
+			"bytes":    rec.bytes,
+			"duration": time.Since(start).String(),
+		}).Info("Handled request")
 	})
 }
+
+// statusRecorder captures the status code and the number of bytes of a response, and the body up to maxLoggedResponse
+// bytes if body is set.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	body   *bytes.Buffer
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	if r.body != nil && r.bytes < maxLoggedResponse {
+		r.body.Write(b[:min(n, maxLoggedResponse-r.bytes)])
+	}
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,1001 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/wilkermichael/scim-prototype/handler"
+)
+
+// testConfig returns the configuration of the given flags, without environment variables, storing resources in memory.
+func testConfig(t *testing.T, args ...string) Config {
+	t.Helper()
+
+	cfg, err := loadTestConfig(args, nil)
+	if err != nil {
+		t.Fatalf("loadConfig(%v): %v", args, err)
+	}
+	return cfg
+}
+
+// testLogger returns a logger discarding its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+// logBuffer collects the output of a logger, it can be read while the server is logging.
+type logBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.b.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.b.String()
+}
+
+// bufferLogger returns a logger at the given level writing to the returned buffer.
+func bufferLogger(level logrus.Level) (*logrus.Logger, *logBuffer) {
+	logger := logrus.New()
+	logs := &logBuffer{}
+	logger.Out = logs
+	logger.SetLevel(level)
+	return logger, logs
+}
+
+// startServer serves newServer of cfg, logging to logger, until the test ends.
+func startServer(t *testing.T, cfg Config, logger *logrus.Logger) *httptest.Server {
+	t.Helper()
+
+	router, closeStores, err := newServer(cfg, logger, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		server.Close()
+		_ = closeStores()
+	})
+	return server
+}
+
+// do sends a request with the given body, if not empty, and header name and value pairs to server and returns the
+// response with its body read.
+func do(t *testing.T, server *httptest.Server, method, path, body string, header ...string) (*http.Response, []byte) {
+	t.Helper()
+
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, server.URL+path, r)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/scim+json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: failed to read the response body: %v", method, path, err)
+	}
+	return resp, b
+}
+
+// decodeJSON decodes the JSON object b.
+func decodeJSON(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+
+	var v map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		t.Fatalf("failed to decode %q: %v", b, err)
+	}
+	return v
+}
+
+// userBody returns the JSON body of a user with the given userName.
+func userBody(userName string) string {
+	return `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "` + userName + `"}`
+}
+
+// createUser creates a user with the given JSON body on server and returns its id.
+func createUser(t *testing.T, server *httptest.Server, body string, header ...string) string {
+	t.Helper()
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", body, header...)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /scim/v2/Users: got status %d, want %d: %s", resp.StatusCode, http.StatusCreated, b)
+	}
+	id, _ := decodeJSON(t, b)["id"].(string)
+	return id
+}
+
+func TestBearerToken(t *testing.T) {
+	server := startServer(t, testConfig(t, "-token", "s3cret"), testLogger())
+
+	tests := []struct {
+		name, method, path string
+		header             []string
+		want               int
+	}{
+		{"valid token", http.MethodGet, "/scim/v2/Users", []string{"Authorization", "Bearer s3cret"}, http.StatusOK},
+		{"missing token", http.MethodGet, "/scim/v2/Users", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/scim/v2/Users", []string{"Authorization", "Bearer wrong"}, http.StatusUnauthorized},
+		{"wrong scheme", http.MethodGet, "/scim/v2/Users", []string{"Authorization", "Basic s3cret"}, http.StatusUnauthorized},
+		{"public service provider config", http.MethodGet, "/scim/v2/ServiceProviderConfig", nil, http.StatusOK},
+		{"path ending like the service provider config", http.MethodPut, "/scim/v2/Users/ServiceProviderConfig", nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, b := do(t, server, test.method, test.path, "", test.header...)
+			if resp.StatusCode != test.want {
+				t.Errorf("got status %d, want %d: %s", resp.StatusCode, test.want, b)
+			}
+			if test.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("got no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestServiceProviderConfig(t *testing.T) {
+	tests := []struct {
+		args              []string
+		bulk, patch       bool
+		maxResults        string
+		bulkMaxOperations string
+	}{
+		{nil, true, true, "200", "1000"},
+		{[]string{"-read-only", "-max-results", "50"}, false, false, "50", "1000"},
+	}
+	for _, test := range tests {
+		server := startServer(t, testConfig(t, test.args...), testLogger())
+		resp, b := do(t, server, http.MethodGet, "/scim/v2/ServiceProviderConfig", "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%v: got status %d, want %d: %s", test.args, resp.StatusCode, http.StatusOK, b)
+		}
+		config := decodeJSON(t, b)
+
+		capability := func(name string) map[string]interface{} {
+			c, _ := config[name].(map[string]interface{})
+			return c
+		}
+		want := map[string]bool{
+			"etag":           true,
+			"sort":           true,
+			"filter":         true,
+			"changePassword": false,
+			"patch":          test.patch,
+			"bulk":           test.bulk,
+		}
+		for name, supported := range want {
+			if got := capability(name)["supported"]; got != supported {
+				t.Errorf("%v: got %s.supported %v, want %v", test.args, name, got, supported)
+			}
+		}
+		if got := capability("filter")["maxResults"]; got != json.Number(test.maxResults) {
+			t.Errorf("%v: got filter.maxResults %v, want %s", test.args, got, test.maxResults)
+		}
+		if got := capability("bulk")["maxOperations"]; got != json.Number(test.bulkMaxOperations) {
+			t.Errorf("%v: got bulk.maxOperations %v, want %s", test.args, got, test.bulkMaxOperations)
+		}
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("done"))
+		}),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(testLogger(), httpServer, func() error { return httpServer.Serve(l) }, stop, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		responses <- result{string(b), err}
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned %v before the pending request completed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Errorf("got response %q and error %v, want the pending request to complete", res.body, res.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+	if _, err := http.Get("http://" + l.Addr().String()); err == nil {
+		t.Error("got a response after shutting down")
+	}
+}
+
+func TestGracefulShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(testLogger(), httpServer, func() error { return httpServer.Serve(l) }, stop, 10*time.Millisecond)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + l.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+	// the request is still in flight after the timeout
+	if err := <-served; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the shutdown to fail with %v", err, context.DeadlineExceeded)
+	}
+}
+
+// downStore is a store that can't be reached.
+type downStore struct {
+	handler.Store
+}
+
+func (downStore) Ping() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if resp, b := do(t, server, http.MethodGet, path, ""); resp.StatusCode != http.StatusOK || string(b) != "ok" {
+			t.Errorf("%s: got status %d and body %q, want %d and ok", path, resp.StatusCode, b, http.StatusOK)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	readyz(testLogger(), handler.NewMemoryStore(), downStore{handler.NewMemoryStore()})(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with a store down: got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	logger, logs := bufferLogger(logrus.InfoLevel)
+	server := startServer(t, testConfig(t), logger)
+
+	resp, _ := do(t, server, http.MethodGet, "/scim/v2/Users", "", handler.RequestIDHeader, "req-42")
+	if got := resp.Header.Get(handler.RequestIDHeader); got != "req-42" {
+		t.Errorf("got %s %q, want req-42", handler.RequestIDHeader, got)
+	}
+	if !strings.Contains(logs.String(), "request_id=req-42") {
+		t.Errorf("got no log line with the request ID: %s", logs)
+	}
+
+	resp, _ = do(t, server, http.MethodGet, "/scim/v2/Users", "")
+	if resp.Header.Get(handler.RequestIDHeader) == "" {
+		t.Errorf("got no generated %s", handler.RequestIDHeader)
+	}
+}
+
+func TestReset(t *testing.T) {
+	server := startServer(t, testConfig(t, "-enable-reset"), testLogger())
+	for _, userName := range []string{"bjensen", "jsmith", "mjones"} {
+		createUser(t, server, userBody(userName))
+	}
+
+	if resp, b := do(t, server, http.MethodPost, "/admin/reset", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusNoContent, b)
+	}
+	_, b := do(t, server, http.MethodGet, "/scim/v2/Users", "")
+	if total := decodeJSON(t, b)["totalResults"]; total != json.Number("0") {
+		t.Errorf("got totalResults %v after reset, want 0", total)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	server := startServer(t, testConfig(t, "-max-results", "5"), testLogger())
+	for i := 0; i < 10; i++ {
+		createUser(t, server, userBody(fmt.Sprintf("user%d", i)))
+	}
+
+	_, b := do(t, server, http.MethodGet, "/scim/v2/Users?count=50", "")
+	body := decodeJSON(t, b)
+	if resources, _ := body["Resources"].([]interface{}); len(resources) != 5 {
+		t.Errorf("got %d resources, want 5", len(resources))
+	}
+	if body["itemsPerPage"] != json.Number("5") {
+		t.Errorf("got itemsPerPage %v, want 5", body["itemsPerPage"])
+	}
+	if body["totalResults"] != json.Number("10") {
+		t.Errorf("got totalResults %v, want 10", body["totalResults"])
+	}
+}
+
+func TestAccessLogStatus(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusTeapot} {
+		logger, logs := bufferLogger(logrus.InfoLevel)
+		m := middleware{logger: logger}
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("body"))
+		})
+
+		w := httptest.NewRecorder()
+		m.loggingMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil))
+		if w.Code != status {
+			t.Errorf("got status %d, want %d", w.Code, status)
+		}
+		if want := fmt.Sprintf("status=%d", status); !strings.Contains(logs.String(), want) || !strings.Contains(logs.String(), "bytes=4") {
+			t.Errorf("got access log %q, want %s and bytes=4", logs, want)
+		}
+	}
+}
+
+func TestStrictAttributes(t *testing.T) {
+	const body = `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bjensen", "favoriteColor": "blue"}`
+
+	lenient := startServer(t, testConfig(t), testLogger())
+	resp, b := do(t, lenient, http.MethodPost, "/scim/v2/Users", body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("lenient: got status %d, want %d: %s", resp.StatusCode, http.StatusCreated, b)
+	}
+	if _, ok := decodeJSON(t, b)["favoriteColor"]; ok {
+		t.Error("lenient: got the unknown attribute, want it dropped")
+	}
+
+	strict := startServer(t, testConfig(t, "-strict-attributes"), testLogger())
+	resp, b = do(t, strict, http.MethodPost, "/scim/v2/Users", body)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("strict: got status %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, b)
+	}
+	if detail, _ := decodeJSON(t, b)["detail"].(string); !strings.Contains(detail, "favoriteColor") {
+		t.Errorf("strict: got detail %q, want it to name favoriteColor", detail)
+	}
+	if resp, b := do(t, strict, http.MethodPost, "/scim/v2/Users", userBody("bjensen")); resp.StatusCode != http.StatusCreated {
+		t.Errorf("strict: got status %d for known attributes, want %d: %s", resp.StatusCode, http.StatusCreated, b)
+	}
+}
+
+// writeSeed writes the seed file content to a temporary file and returns its path.
+func writeSeed(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "seed.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestMe(t *testing.T) {
+	seed := writeSeed(t, `{"Users": [{"id": "2819c223", "userName": "bjensen"}, {"id": "902c246b", "userName": "jsmith"}]}`)
+	server := startServer(t, testConfig(t, "-seed", seed, "-token", "s3cret", "-token-user", "2819c223"), testLogger())
+
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Me", "", "Authorization", "Bearer s3cret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	if user := decodeJSON(t, b); user["id"] != "2819c223" || user["userName"] != "bjensen" {
+		t.Errorf("got %v, want bjensen", user)
+	}
+
+	if resp, b := do(t, server, http.MethodGet, "/scim/v2/Me", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: got status %d, want %d: %s", resp.StatusCode, http.StatusUnauthorized, b)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	server := startServer(t, testConfig(t, "-cors-origins", "https://admin.example.com"), testLogger())
+
+	resp, _ := do(t, server, http.MethodOptions, "/scim/v2/Users", "",
+		"Origin", "https://admin.example.com",
+		"Access-Control-Request-Method", http.MethodPost,
+		"Access-Control-Request-Headers", "authorization,content-type")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("preflight: got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("preflight: got Access-Control-Allow-Origin %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodPost) {
+		t.Errorf("preflight: got Access-Control-Allow-Methods %q, want POST allowed", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") {
+		t.Errorf("preflight: got Access-Control-Allow-Headers %q, want Authorization allowed", got)
+	}
+
+	resp, _ = do(t, server, http.MethodGet, "/scim/v2/Users", "", "Origin", "https://admin.example.com")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "https://admin.example.com" {
+		t.Errorf("simple request: got status %d and Access-Control-Allow-Origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "Etag") {
+		t.Errorf("simple request: got Access-Control-Expose-Headers %q, want Etag exposed", resp.Header.Get("Access-Control-Expose-Headers"))
+	}
+
+	resp, _ = do(t, server, http.MethodGet, "/scim/v2/Users", "", "Origin", "https://evil.example.com")
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("other origin: got Access-Control-Allow-Origin %q, want none", got)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+
+	tests := []struct {
+		contentType string
+		wantStatus  int
+	}{
+		{"application/scim+json", http.StatusCreated},
+		{"application/json; charset=utf-8", http.StatusCreated},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"", http.StatusUnsupportedMediaType},
+	}
+	for i, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", userBody(fmt.Sprintf("user%d", i)), "Content-Type", test.contentType)
+			if resp.StatusCode != test.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, test.wantStatus, b)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/scim+json" {
+				t.Errorf("got Content-Type %q, want application/scim+json", got)
+			}
+			if test.wantStatus == http.StatusUnsupportedMediaType {
+				if got := decodeJSON(t, b)["status"]; got != "415" {
+					t.Errorf("got error status %v, want 415", got)
+				}
+			}
+		})
+	}
+
+	resp, _ := do(t, server, http.MethodGet, "/scim/v2/Users", "")
+	if got := resp.Header.Get("Content-Type"); got != "application/scim+json" {
+		t.Errorf("GET: got Content-Type %q, want application/scim+json", got)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	const baseURL = "https://idp.example.com/tenant1/scim/v2"
+	server := startServer(t, testConfig(t, "-base-url", baseURL+"/"), testLogger())
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", userBody("bjensen"))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", resp.StatusCode, http.StatusCreated, b)
+	}
+	user := decodeJSON(t, b)
+	want := baseURL + "/Users/" + user["id"].(string)
+	if got := resp.Header.Get("Location"); got != want {
+		t.Errorf("POST: got Location %q, want %q", got, want)
+	}
+	if got := user["meta"].(map[string]interface{})["location"]; got != want {
+		t.Errorf("POST: got meta.location %v, want %q", got, want)
+	}
+
+	_, b = do(t, server, http.MethodGet, "/scim/v2/Users/"+user["id"].(string), "")
+	if got := decodeJSON(t, b)["meta"].(map[string]interface{})["location"]; got != want {
+		t.Errorf("GET: got meta.location %v, want %q", got, want)
+	}
+	_, b = do(t, server, http.MethodGet, "/scim/v2/Users", "")
+	resources := decodeJSON(t, b)["Resources"].([]interface{})
+	if got := resources[0].(map[string]interface{})["meta"].(map[string]interface{})["location"]; got != want {
+		t.Errorf("list: got meta.location %v, want %q", got, want)
+	}
+}
+
+func TestMalformedJSON(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+
+	tests := []struct {
+		name, method, path, body, wantDetail string
+	}{
+		{"truncated create", http.MethodPost, "/scim/v2/Users", `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bjen`, "unexpected end of JSON input"},
+		{"invalid character", http.MethodPost, "/scim/v2/Users", `{"userName": bjensen}`, "offset 14"},
+		{"truncated patch", http.MethodPatch, "/scim/v2/Users/2819c223", `{"Operations": [`, "unexpected end of JSON input"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, b := do(t, server, test.method, test.path, test.body)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, b)
+			}
+			body := decodeJSON(t, b)
+			if body["scimType"] != "invalidSyntax" || body["status"] != "400" {
+				t.Errorf("got scimType %v and status %v, want invalidSyntax and 400", body["scimType"], body["status"])
+			}
+			if schemas, _ := body["schemas"].([]interface{}); len(schemas) != 1 || schemas[0] != "urn:ietf:params:scim:api:messages:2.0:Error" {
+				t.Errorf("got schemas %v, want the error message schema", body["schemas"])
+			}
+			if detail, _ := body["detail"].(string); !strings.Contains(detail, test.wantDetail) {
+				t.Errorf("got detail %q, want it to contain %q", detail, test.wantDetail)
+			}
+		})
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	server := startServer(t, testConfig(t, "-soft-delete"), testLogger())
+	id := createUser(t, server, userBody("bjensen"))
+
+	if resp, b := do(t, server, http.MethodDelete, "/scim/v2/Users/"+id, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: got status %d, want %d: %s", resp.StatusCode, http.StatusNoContent, b)
+	}
+	if resp, _ := do(t, server, http.MethodGet, "/scim/v2/Users/"+id, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after DELETE: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if _, b := do(t, server, http.MethodGet, "/scim/v2/Users", ""); decodeJSON(t, b)["totalResults"] != json.Number("0") {
+		t.Errorf("list after DELETE: got %s, want no users", b)
+	}
+
+	// the userName of the deleted user is taken again
+	other := createUser(t, server, userBody("bjensen"))
+	if resp, b := do(t, server, http.MethodPost, "/admin/undelete/Users/"+id, ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("undelete of a taken userName: got status %d, want %d: %s", resp.StatusCode, http.StatusConflict, b)
+	}
+	do(t, server, http.MethodDelete, "/scim/v2/Users/"+other, "")
+
+	if resp, b := do(t, server, http.MethodPost, "/admin/undelete/Users/"+id, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("undelete: got status %d, want %d: %s", resp.StatusCode, http.StatusNoContent, b)
+	}
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Users/"+id, "")
+	if resp.StatusCode != http.StatusOK || decodeJSON(t, b)["userName"] != "bjensen" {
+		t.Errorf("GET after undelete: got status %d, want %d with the user: %s", resp.StatusCode, http.StatusOK, b)
+	}
+
+	for _, path := range []string{"/admin/undelete/Users/" + id, "/admin/undelete/Users/missing", "/admin/undelete/Things/" + id} {
+		if resp, _ := do(t, server, http.MethodPost, path, ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s: got status %d, want %d", path, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	server := startServer(t, testConfig(t, "-max-body-size", "1024"), testLogger())
+	oversized := `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bjensen", "nickName": "` + strings.Repeat("x", 2048) + `"}`
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", oversized)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusRequestEntityTooLarge, b)
+	}
+	if got := decodeJSON(t, b)["status"]; got != "413" {
+		t.Errorf("got error status %v, want 413", got)
+	}
+
+	// a chunked body has no Content-Length, it is cut off while reading
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/scim/v2/Users", io.MultiReader(strings.NewReader(oversized)))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/scim+json")
+	resp, err = server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked: got status %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	if _, b := do(t, server, http.MethodGet, "/scim/v2/Users", ""); decodeJSON(t, b)["totalResults"] != json.Number("0") {
+		t.Errorf("got %s, want no users created", b)
+	}
+	createUser(t, server, userBody("bjensen"))
+}
+
+func TestLoggingMiddlewareBody(t *testing.T) {
+	for _, body := range []string{
+		"userName=bjensen&nickName=Babs",
+		`{"userName": "bjensen", "nickName": `,
+		"\x00\xff binary \xfe",
+		`{"userName": "bjensen"}`,
+	} {
+		logger, logs := bufferLogger(logrus.DebugLevel)
+		m := middleware{logger: logger}
+		var received []byte
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		m.loggingMiddleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scim/v2/Users", strings.NewReader(body)))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("body %q: got status %d, want %d", body, w.Code, http.StatusNoContent)
+		}
+		if string(received) != body {
+			t.Errorf("got body %q in the handler, want %q", received, body)
+		}
+		if !strings.Contains(logs.String(), "Request body") {
+			t.Errorf("body %q: got logs %q, want the request body logged", body, logs)
+		}
+	}
+}
+
+func TestValidationProblems(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"],
+		"nickName": "Babs",
+		"active": "yes",
+		"emails": [{"value": "bjensen@example.com", "type": "invalid"}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"employeeNumber": 701984}
+	}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, b)
+	}
+	body := decodeJSON(t, b)
+	if body["scimType"] != "invalidValue" {
+		t.Errorf("got scimType %v, want invalidValue", body["scimType"])
+	}
+	detail, _ := body["detail"].(string)
+	for _, problem := range []string{
+		"userName is required",
+		"active is not a valid boolean value",
+		`emails.type "invalid" is not one of`,
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber is not a valid string value",
+	} {
+		if !strings.Contains(detail, problem) {
+			t.Errorf("got detail %q, want it to report %q", detail, problem)
+		}
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	server := startServer(t, testConfig(t, "-token", "s3cret"), testLogger())
+	auth := []string{"Authorization", "Bearer s3cret"}
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "bjensen",
+		"name": {"givenName": "Barbara", "familyName": "Jensen"}
+	}`, auth...)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: got status %d, want %d: %s", resp.StatusCode, http.StatusCreated, b)
+	}
+	created := decodeJSON(t, b)
+	id, _ := created["id"].(string)
+	if id == "" || created["userName"] != "bjensen" || resp.Header.Get("Etag") == "" {
+		t.Fatalf("POST: got %s with ETag %q, want the user with an id and ETag", b, resp.Header.Get("Etag"))
+	}
+	if meta, _ := created["meta"].(map[string]interface{}); meta["resourceType"] != "User" || meta["location"] != "Users/"+id {
+		t.Errorf("POST: got meta %v", created["meta"])
+	}
+
+	resp, b = do(t, server, http.MethodGet, "/scim/v2/Users/"+id, "", auth...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	if user := decodeJSON(t, b); user["id"] != id || user["name"].(map[string]interface{})["givenName"] != "Barbara" {
+		t.Errorf("GET: got %s, want the created user", b)
+	}
+
+	resp, b = do(t, server, http.MethodPatch, "/scim/v2/Users/"+id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "name.givenName", "value": "Babs"}, {"op": "add", "path": "nickName", "value": "Babs"}]
+	}`, auth...)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	patched := decodeJSON(t, b)
+	if patched["nickName"] != "Babs" || patched["name"].(map[string]interface{})["givenName"] != "Babs" {
+		t.Errorf("PATCH: got %s, want the patched user", b)
+	}
+	if patched["name"].(map[string]interface{})["familyName"] != "Jensen" {
+		t.Errorf("PATCH: got %s, want familyName kept", b)
+	}
+
+	if _, b = do(t, server, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`nickName eq "Babs"`), "", auth...); decodeJSON(t, b)["totalResults"] != json.Number("1") {
+		t.Errorf("list: got %s, want the patched user", b)
+	}
+
+	if resp, b = do(t, server, http.MethodDelete, "/scim/v2/Users/"+id, "", auth...); resp.StatusCode != http.StatusNoContent || len(b) != 0 {
+		t.Fatalf("DELETE: got status %d with body %q, want %d without one", resp.StatusCode, b, http.StatusNoContent)
+	}
+	resp, b = do(t, server, http.MethodGet, "/scim/v2/Users/"+id, "", auth...)
+	if resp.StatusCode != http.StatusNotFound || decodeJSON(t, b)["status"] != "404" {
+		t.Errorf("GET after DELETE: got status %d, want a SCIM %d: %s", resp.StatusCode, http.StatusNotFound, b)
+	}
+
+	// the SCIM API is only served below its prefix and with the token
+	if resp, _ := do(t, server, http.MethodGet, "/Users", "", auth...); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /Users: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp, _ := do(t, server, http.MethodGet, "/scim/v2/Users", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestMaxFilterLength(t *testing.T) {
+	server := startServer(t, testConfig(t, "-max-filter-length", "64"), testLogger())
+	createUser(t, server, userBody("bjensen"))
+	long := `userName eq "bjensen"` + strings.Repeat(` or userName eq "bjensen"`, 100)
+
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(long), "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET: got status %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, b)
+	}
+	body := decodeJSON(t, b)
+	if body["scimType"] != "invalidFilter" || !strings.Contains(body["detail"].(string), "the maximum is 64") {
+		t.Errorf("GET: got %s, want an invalidFilter error naming the maximum", b)
+	}
+
+	search, _ := json.Marshal(map[string]string{"filter": long})
+	if resp, b := do(t, server, http.MethodPost, "/scim/v2/Users/.search", string(search)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("search: got status %d, want %d: %s", resp.StatusCode, http.StatusBadRequest, b)
+	}
+
+	resp, b = do(t, server, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq "bjensen"`), "")
+	if resp.StatusCode != http.StatusOK || decodeJSON(t, b)["totalResults"] != json.Number("1") {
+		t.Errorf("short filter: got status %d, want %d with the user: %s", resp.StatusCode, http.StatusOK, b)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	for _, pretty := range []bool{true, false} {
+		t.Run(fmt.Sprint("pretty ", pretty), func(t *testing.T) {
+			server := startServer(t, testConfig(t, fmt.Sprintf("-pretty=%v", pretty)), testLogger())
+			id := createUser(t, server, userBody("bjensen"))
+
+			for _, path := range []string{"/scim/v2/Users/" + id, "/scim/v2/Users", "/scim/v2/Users/missing"} {
+				_, b := do(t, server, http.MethodGet, path, "")
+				if indented := bytes.Contains(b, []byte("\n  \"")); indented != pretty {
+					t.Errorf("GET %s: got indented %v, want %v: %s", path, indented, pretty, b)
+				}
+				if !json.Valid(b) {
+					t.Errorf("GET %s: got invalid JSON %s", path, b)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownEndpoint(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+
+	for _, path := range []string{"/scim/v2/Things", "/scim/v2/Things/2819c223", "/scim/Users", "/scim"} {
+		resp, b := do(t, server, http.MethodGet, path, "")
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: got status %d, want %d: %s", path, resp.StatusCode, http.StatusNotFound, b)
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != "application/scim+json" {
+			t.Errorf("GET %s: got Content-Type %q, want application/scim+json", path, got)
+		}
+		body := decodeJSON(t, b)
+		if schemas, _ := body["schemas"].([]interface{}); len(schemas) != 1 || schemas[0] != "urn:ietf:params:scim:api:messages:2.0:Error" || body["status"] != "404" {
+			t.Errorf("GET %s: got %s, want a SCIM 404 error", path, b)
+		}
+	}
+
+	// other paths are not part of the SCIM API
+	if resp, b := do(t, server, http.MethodGet, "/favicon.ico", ""); resp.StatusCode != http.StatusNotFound || json.Valid(b) {
+		t.Errorf("GET /favicon.ico: got status %d with body %q, want a plain 404", resp.StatusCode, b)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	seed := writeSeed(t, `{"Users": [{"id": "2819c223", "userName": "bjensen"}]}`)
+	server := startServer(t, testConfig(t, "-read-only", "-seed", seed), testLogger())
+
+	resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", userBody("jsmith"))
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Fatalf("POST: got status %d, want %d: %s", resp.StatusCode, http.StatusNotImplemented, b)
+	}
+	if body := decodeJSON(t, b); body["status"] != "501" || !strings.Contains(body["detail"].(string), "Create") {
+		t.Errorf("POST: got %s, want a SCIM 501 error naming Create", b)
+	}
+	if resp, b := do(t, server, http.MethodGet, "/scim/v2/Users/2819c223", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+}
+
+func TestDump(t *testing.T) {
+	const password = "t1meMa$heen"
+	if resp, _ := do(t, startServer(t, testConfig(t), testLogger()), http.MethodGet, "/admin/dump", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dump disabled: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	server := startServer(t, testConfig(t, "-enable-dump"), testLogger())
+	ids := make(map[string]string)
+	for _, userName := range []string{"bjensen", "jsmith", "mmoe"} {
+		ids[createUser(t, server, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "`+userName+`", "password": "`+password+`"}`)] = userName
+	}
+
+	resp, b := do(t, server, http.MethodGet, "/admin/dump", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/dump: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("got Content-Type %q, want application/x-ndjson", got)
+	}
+	if bytes.Contains(b, []byte("password")) {
+		t.Errorf("got a password in the dump %s", b)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != len(ids) {
+		t.Fatalf("got %d lines, want %d: %s", len(lines), len(ids), b)
+	}
+	for _, line := range lines {
+		resource := decodeJSON(t, []byte(line))
+		id, _ := resource["id"].(string)
+		if userName, ok := ids[id]; !ok || resource["userName"] != userName {
+			t.Errorf("got unexpected resource %s", line)
+		}
+		delete(ids, id)
+	}
+	if len(ids) != 0 {
+		t.Errorf("got no lines for the users %v", ids)
+	}
+}
+
+func TestLogResponses(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		level logrus.Level
+		want  bool
+	}{
+		{"trace", []string{"-log-responses"}, logrus.TraceLevel, true},
+		{"debug", []string{"-log-responses"}, logrus.DebugLevel, false},
+		{"not enabled", nil, logrus.TraceLevel, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, logs := bufferLogger(test.level)
+			server := startServer(t, testConfig(t, test.args...), logger)
+			id := createUser(t, server, userBody("bjensen"))
+			if resp, b := do(t, server, http.MethodGet, "/scim/v2/Users/"+id, ""); resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+			}
+
+			// only the responses have meta.resourceType
+			got := strings.Contains(logs.String(), "Response body") && strings.Contains(logs.String(), "resourceType")
+			if got != test.want {
+				t.Errorf("got response bodies logged %v, want %v: %s", got, test.want, logs)
+			}
+		})
+	}
+}
+
+func TestCheckSchemas(t *testing.T) {
+	const (
+		core       = `"urn:ietf:params:scim:schemas:core:2.0:User"`
+		enterprise = `"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`
+	)
+	server := startServer(t, testConfig(t), testLogger())
+
+	tests := []struct {
+		name, body, wantDetail string
+		want                   int
+	}{
+		{"missing core schema", `{"schemas": [` + enterprise + `], "userName": "bjensen"}`,
+			"The schemas attribute must contain urn:ietf:params:scim:schemas:core:2.0:User.", http.StatusBadRequest},
+		{"missing extension schema", `{"schemas": [` + core + `], "userName": "bjensen", ` + enterprise + `: {"department": "Tour Operations"}}`,
+			"The schemas attribute must contain urn:ietf:params:scim:schemas:extension:enterprise:2.0:User, attributes of that extension are present.", http.StatusBadRequest},
+		{"both schemas", `{"schemas": [` + core + `, ` + enterprise + `], "userName": "bjensen", ` + enterprise + `: {"department": "Tour Operations"}}`,
+			"", http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, b := do(t, server, http.MethodPost, "/scim/v2/Users", test.body)
+			if resp.StatusCode != test.want {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, test.want, b)
+			}
+			if test.wantDetail == "" {
+				return
+			}
+			body := decodeJSON(t, b)
+			if body["scimType"] != "invalidValue" || body["detail"] != test.wantDetail {
+				t.Errorf("got scimType %v and detail %v, want invalidValue and %q", body["scimType"], body["detail"], test.wantDetail)
+			}
+		})
+	}
+}
+
+func TestDoubledVersionSegment(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+	id := createUser(t, server, userBody("bjensen"))
+
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodGet, "/scim/v2/v2/Users", ""},
+		{http.MethodGet, "/scim/v2/v2/Users/" + id, ""},
+		{http.MethodPost, "/scim/v2/V2/Users", userBody("jsmith")},
+	} {
+		resp, b := do(t, server, req.method, req.path, req.body)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s: got status %d, want %d: %s", req.method, req.path, resp.StatusCode, http.StatusNotFound, b)
+			continue
+		}
+		body := decodeJSON(t, b)
+		if schemas, _ := body["schemas"].([]interface{}); len(schemas) != 1 || schemas[0] != "urn:ietf:params:scim:api:messages:2.0:Error" || body["status"] != "404" {
+			t.Errorf("%s %s: got %s, want a SCIM 404 error", req.method, req.path, b)
+		}
+		if detail, _ := body["detail"].(string); !strings.Contains(detail, "check the base URL") {
+			t.Errorf("%s %s: got detail %q, want a hint at the base URL", req.method, req.path, detail)
+		}
+	}
+
+	// the rejected create didn't reach the server
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Users", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /scim/v2/Users: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	if total := decodeJSON(t, b)["totalResults"]; total != json.Number("1") {
+		t.Errorf("got %v users, want 1", total)
+	}
+}
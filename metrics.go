@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/wilkermichael/scim-prototype/handler"
+)
+
+// metrics holds the Prometheus collectors of the SCIM server.
+type metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// newMetrics registers the request metrics and a gauge counting the resources of each store with reg.
+func newMetrics(reg prometheus.Registerer, logger *logrus.Logger, stores map[string]handler.Store) *metrics {
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scim_requests_total",
+			Help: "Number of SCIM requests by method, endpoint and status code.",
+		}, []string{"method", "endpoint", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scim_request_duration_seconds",
+			Help:    "Duration of SCIM requests by method and endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "endpoint"}),
+	}
+	reg.MustRegister(m.requests, m.duration)
+
+	for resourceType, store := range stores {
+		store := store
+		reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "scim_resources",
+			Help:        "Number of resources in the store by resource type.",
+			ConstLabels: prometheus.Labels{"resource_type": resourceType},
+		}, func() float64 {
+			n, err := handler.Count(store)
+			if err != nil {
+				logger.Errorf("Failed to count %s resources: %v", resourceType, err)
+				return 0
+			}
+			return float64(n)
+		}))
+	}
+	return m
+}
+
+// middleware records the count and duration of each request.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		endpoint := endpointLabel(r)
+		m.requests.WithLabelValues(r.Method, endpoint, strconv.Itoa(rec.status)).Inc()
+		m.duration.WithLabelValues(r.Method, endpoint).Observe(time.Since(start).Seconds())
+	})
+}
+
+// scimEndpoints are the endpoints of the SCIM API that are labeled as such, requests to any other path under /scim/v2
+// are labeled "other".
+var scimEndpoints = map[string]bool{
+	"Users":                 true,
+	"Groups":                true,
+	"Schemas":               true,
+	"ResourceTypes":         true,
+	"ServiceProviderConfig": true,
+}
+
+// endpointLabel maps a request to the path template of its route to bound the label cardinality, e.g.
+// `/admin/undelete/Users/2819c223` to `/admin/undelete/{resourceType}/{id}`. Requests served by the SCIM API route are
+// mapped to their endpoint without resource ids, e.g. `/scim/v2/Users/2819c223` to `/scim/v2/Users/{id}`, or to "other"
+// for unknown endpoints.
+func endpointLabel(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "other"
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "other"
+	}
+	if template != "/scim/v2/" {
+		return template
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(r.URL.Path, template), "/", 2)
+	if !scimEndpoints[segments[0]] {
+		return "other"
+	}
+	if len(segments) > 1 && segments[1] != "" {
+		return template + segments[0] + "/{id}"
+	}
+	return template + segments[0]
+}
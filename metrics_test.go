@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+	createUser(t, server, userBody("bjensen"))
+	createUser(t, server, userBody("jsmith"))
+	do(t, server, http.MethodGet, "/scim/v2/Users/missing", "")
+
+	resp, b := do(t, server, http.MethodGet, "/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	for _, want := range []string{
+		`scim_requests_total{endpoint="/scim/v2/Users",method="POST",status="201"} 2`,
+		`scim_requests_total{endpoint="/scim/v2/Users/{id}",method="GET",status="404"} 1`,
+		`scim_request_duration_seconds_count{endpoint="/scim/v2/Users",method="POST"} 2`,
+		`scim_resources{resource_type="User"} 2`,
+		`scim_resources{resource_type="Group"} 0`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("got no %s in:\n%s", want, b)
+		}
+	}
+}
+
+func TestEndpointLabel(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+	for _, path := range []string{"/scim/v2/Users/a", "/scim/v2/Users/b", "/scim/v2/Bogus/c", "/scim/v2/Bogus/d"} {
+		do(t, server, http.MethodGet, path, "")
+	}
+
+	_, b := do(t, server, http.MethodGet, "/metrics", "")
+	for _, want := range []string{
+		`scim_requests_total{endpoint="/scim/v2/Users/{id}",method="GET",status="404"} 2`,
+		`scim_requests_total{endpoint="other",method="GET",status="404"} 2`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("got no %s in:\n%s", want, b)
+		}
+	}
+}
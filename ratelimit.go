@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elimity-com/scim/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/wilkermichael/scim-prototype/handler"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTimeout is how long the limiter of a client IP is kept after its last request.
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// rateLimiter sheds load with 429 responses using token buckets, either one for all requests or one per client IP.
+type rateLimiter struct {
+	logger *logrus.Logger
+	limit  rate.Limit
+	burst  int
+	perIP  bool
+
+	mu        sync.Mutex
+	global    *rate.Limiter
+	clients   map[string]*client
+	lastPrune time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns a limiter allowing limit requests per second with the given burst, by is global or ip.
+func newRateLimiter(logger *logrus.Logger, limit float64, burst int, by string) (*rateLimiter, error) {
+	if limit <= 0 || burst < 1 {
+		return nil, fmt.Errorf("invalid rate limit %v with burst %d, expected positive numbers", limit, burst)
+	}
+	l := &rateLimiter{
+		logger:  logger,
+		limit:   rate.Limit(limit),
+		burst:   burst,
+		clients: make(map[string]*client),
+	}
+	switch by {
+	case "global":
+		l.global = rate.NewLimiter(l.limit, burst)
+	case "ip":
+		l.perIP = true
+	default:
+		return nil, fmt.Errorf("invalid rate limit key %q, expected global or ip", by)
+	}
+	return l, nil
+}
+
+// limiter returns the token bucket of the request.
+func (l *rateLimiter) limiter(r *http.Request) *rate.Limiter {
+	if !l.perIP {
+		return l.global
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > rateLimiterIdleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := l.limiter(r).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			handler.RequestLogger(l.logger, r).Warnf("Rate limit exceeded: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(delay.Seconds()))))
+			handler.WriteError(w, errors.ScimError{
+				Detail: "Too many requests, retry later.",
+				Status: http.StatusTooManyRequests,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := startServer(t, testConfig(t, "-rate-limit", "0.001", "-rate-burst", "3"), testLogger())
+
+	for i := 0; i < 3; i++ {
+		if resp, b := do(t, server, http.MethodGet, "/scim/v2/Users", ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want %d: %s", i, resp.StatusCode, http.StatusOK, b)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		resp, b := do(t, server, http.MethodGet, "/scim/v2/Users", "")
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("request over the limit: got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("request over the limit: got no Retry-After header")
+		}
+		if got := decodeJSON(t, b)["status"]; got != "429" {
+			t.Errorf("request over the limit: got error status %v, want 429", got)
+		}
+	}
+
+	// health checks are not limited
+	if resp, _ := do(t, server, http.MethodGet, "/healthz", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	limiter, err := newRateLimiter(testLogger(), 0.001, 1, "ip")
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	h := limiter.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	status := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if got := status("192.0.2.1:1234"); got != http.StatusOK {
+		t.Errorf("first client: got status %d, want %d", got, http.StatusOK)
+	}
+	if got := status("192.0.2.1:5678"); got != http.StatusTooManyRequests {
+		t.Errorf("first client again: got status %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := status("192.0.2.2:1234"); got != http.StatusOK {
+		t.Errorf("second client: got status %d, want %d", got, http.StatusOK)
+	}
+}
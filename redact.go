@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+)
+
+// redactedValue replaces the values of redacted attributes in logs.
+const redactedValue = "[REDACTED]"
+
+// redact replaces the values of the given attributes in the decoded JSON value v, at any depth, with redactedValue.
+// The value of a patch operation whose path addresses one of the attributes, e.g. `password` or
+// `urn:...:User:password`, is redacted as well. Attribute names are case-insensitive.
+func redact(v interface{}, attributes []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if path, ok := v["path"].(string); ok && isRedacted(attributePathName(path), attributes) {
+			if _, ok := v["value"]; ok {
+				v["value"] = redactedValue
+			}
+		}
+		for k, value := range v {
+			if isRedacted(k, attributes) {
+				v[k] = redactedValue
+				continue
+			}
+			redact(value, attributes)
+		}
+	case []interface{}:
+		for _, value := range v {
+			redact(value, attributes)
+		}
+	}
+}
+
+// attributePathName returns the name of the attribute addressed by a patch path, e.g. `givenName` for `name.givenName`.
+func attributePathName(path string) string {
+	if i := strings.LastIndexAny(path, ":."); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// isRedacted reports whether name is one of the redacted attributes.
+func isRedacted(name string, attributes []string) bool {
+	for _, attribute := range attributes {
+		if strings.EqualFold(name, attribute) {
+			return true
+		}
+	}
+	return false
+}
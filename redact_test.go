@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactedRequestLog(t *testing.T) {
+	const password = "t1meMa$heen"
+	logger, logs := bufferLogger(logrus.DebugLevel)
+	server := startServer(t, testConfig(t), logger)
+
+	id := createUser(t, server, `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "bjensen", "password": "`+password+`"}`)
+	resp, b := do(t, server, http.MethodPatch, "/scim/v2/Users/"+id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "password", "value": "`+password+`2"}]
+	}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+
+	if strings.Contains(logs.String(), password) {
+		t.Errorf("got the password in the logs %q", logs)
+	}
+	if got := strings.Count(logs.String(), redactedValue); got < 2 {
+		t.Errorf("got %d redacted values in the logs %q, want the password of both requests redacted", got, logs)
+	}
+	if !strings.Contains(logs.String(), "bjensen") {
+		t.Errorf("got logs %q, want the other attributes logged", logs)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	v := map[string]interface{}{
+		"userName": "bjensen",
+		"PASSWORD": "secret",
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"password": "secret"},
+		"Operations": []interface{}{
+			map[string]interface{}{"op": "replace", "path": "urn:ietf:params:scim:schemas:core:2.0:User:password", "value": "secret"},
+			map[string]interface{}{"op": "replace", "path": "nickName", "value": "Babs"},
+			map[string]interface{}{"op": "replace", "value": map[string]interface{}{"password": "secret"}},
+		},
+	}
+	redact(v, []string{"password"})
+
+	want := map[string]interface{}{
+		"userName": "bjensen",
+		"PASSWORD": redactedValue,
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": map[string]interface{}{"password": redactedValue},
+		"Operations": []interface{}{
+			map[string]interface{}{"op": "replace", "path": "urn:ietf:params:scim:schemas:core:2.0:User:password", "value": redactedValue},
+			map[string]interface{}{"op": "replace", "path": "nickName", "value": "Babs"},
+			map[string]interface{}{"op": "replace", "value": map[string]interface{}{"password": redactedValue}},
+		},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %v, want %v", v, want)
+	}
+}
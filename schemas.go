@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elimity-com/scim"
+	"github.com/elimity-com/scim/optional"
+	scimSchema "github.com/elimity-com/scim/schema"
+)
+
+// userSchema returns the core User schema.
+func userSchema() scimSchema.Schema {
+	return scimSchema.Schema{
+		ID:          scimSchema.UserSchema,
+		Name:        optional.NewString("User"),
+		Description: optional.NewString("User Account"),
+		Attributes: []scimSchema.CoreAttribute{
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Unique identifier for the User, typically used by the user to directly authenticate to the service provider."),
+				Name:        "userName",
+				Required:    true,
+				Uniqueness:  scimSchema.AttributeUniquenessServer(),
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("A String that is an identifier for the resource as defined by the provisioning client."),
+				CaseExact:   true,
+				Name:        "externalId",
+				Uniqueness:  scimSchema.AttributeUniquenessServer(),
+			})),
+			scimSchema.ComplexCoreAttribute(scimSchema.ComplexParams{
+				Description: optional.NewString("The components of the user's real name."),
+				Name:        "name",
+				SubAttributes: []scimSchema.SimpleParams{
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The full name, including all middle names, titles, and suffixes as appropriate, formatted for display."),
+						Name:        "formatted",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The family name of the User, or last name in most Western languages."),
+						Name:        "familyName",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The given name of the User, or first name in most Western languages."),
+						Name:        "givenName",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The middle name(s) of the User."),
+						Name:        "middleName",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The honorific prefix(es) of the User, or title in most Western languages."),
+						Name:        "honorificPrefix",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The honorific suffix(es) of the User, or suffix in most Western languages."),
+						Name:        "honorificSuffix",
+					}),
+				},
+			}),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("The casual way to address the user in real life."),
+				Name:        "nickName",
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("The User's cleartext password, used to set or compare it. It is stored hashed and never returned."),
+				Mutability:  scimSchema.AttributeMutabilityWriteOnly(),
+				Name:        "password",
+				Returned:    scimSchema.AttributeReturnedNever(),
+			})),
+			scimSchema.ComplexCoreAttribute(scimSchema.ComplexParams{
+				Description: optional.NewString("Email addresses for the user."),
+				MultiValued: true,
+				Name:        "emails",
+				SubAttributes: []scimSchema.SimpleParams{
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("Email addresses for the user."),
+						Name:        "value",
+						Required:    true,
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("A human-readable name, primarily used for display purposes."),
+						Name:        "display",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						CanonicalValues: []string{"work", "home", "other"},
+						Description:     optional.NewString("A label indicating the attribute's function, e.g., 'work' or 'home'."),
+						Name:            "type",
+					}),
+					scimSchema.SimpleBooleanParams(scimSchema.BooleanParams{
+						Description: optional.NewString("A Boolean value indicating the 'primary' or preferred attribute value for this attribute."),
+						Name:        "primary",
+					}),
+				},
+			}),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleBooleanParams(scimSchema.BooleanParams{
+				Description: optional.NewString("A boolean denoting that the user is either active or disabled."),
+				Name:        "active",
+				Required:    false,
+			})),
+		},
+	}
+}
+
+// groupSchema returns the core Group schema.
+func groupSchema() scimSchema.Schema {
+	return scimSchema.Schema{
+		ID:          scimSchema.GroupSchema,
+		Name:        optional.NewString("Group"),
+		Description: optional.NewString("Group"),
+		Attributes: []scimSchema.CoreAttribute{
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("A human-readable name for the Group."),
+				Name:        "displayName",
+				Required:    true,
+			})),
+			scimSchema.ComplexCoreAttribute(scimSchema.ComplexParams{
+				Description: optional.NewString("A list of members of the Group."),
+				MultiValued: true,
+				Name:        "members",
+				SubAttributes: []scimSchema.SimpleParams{
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("Identifier of the member of this Group."),
+						Mutability:  scimSchema.AttributeMutabilityImmutable(),
+						Name:        "value",
+					}),
+					scimSchema.SimpleReferenceParams(scimSchema.ReferenceParams{
+						Description:    optional.NewString("The URI corresponding to a SCIM resource that is a member of this Group."),
+						Mutability:     scimSchema.AttributeMutabilityImmutable(),
+						Name:           "$ref",
+						ReferenceTypes: []scimSchema.AttributeReferenceType{"User", "Group"},
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("A human-readable name for the member."),
+						Mutability:  scimSchema.AttributeMutabilityImmutable(),
+						Name:        "display",
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						CanonicalValues: []string{"User", "Group"},
+						Description:     optional.NewString("A label indicating the type of resource, e.g., 'User' or 'Group'."),
+						Mutability:      scimSchema.AttributeMutabilityImmutable(),
+						Name:            "type",
+					}),
+				},
+			}),
+		},
+	}
+}
+
+// enterpriseUserSchema returns the enterprise User extension, see RFC 7643, section 4.3.
+func enterpriseUserSchema() scimSchema.Schema {
+	return scimSchema.Schema{
+		ID:          "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User",
+		Name:        optional.NewString("EnterpriseUser"),
+		Description: optional.NewString("Enterprise User"),
+		Attributes: []scimSchema.CoreAttribute{
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Numeric or alphanumeric identifier assigned to a person, typically based on order of hire or association with an organization."),
+				Name:        "employeeNumber",
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Identifies the name of a cost center."),
+				Name:        "costCenter",
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Identifies the name of an organization."),
+				Name:        "organization",
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Identifies the name of a division."),
+				Name:        "division",
+			})),
+			scimSchema.SimpleCoreAttribute(scimSchema.SimpleStringParams(scimSchema.StringParams{
+				Description: optional.NewString("Identifies the name of a department."),
+				Name:        "department",
+			})),
+			scimSchema.ComplexCoreAttribute(scimSchema.ComplexParams{
+				Description: optional.NewString("The User's manager."),
+				Name:        "manager",
+				SubAttributes: []scimSchema.SimpleParams{
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The id of the SCIM resource representing the User's manager."),
+						Name:        "value",
+					}),
+					scimSchema.SimpleReferenceParams(scimSchema.ReferenceParams{
+						Description:    optional.NewString("The URI of the SCIM resource representing the User's manager."),
+						Name:           "$ref",
+						ReferenceTypes: []scimSchema.AttributeReferenceType{"User"},
+					}),
+					scimSchema.SimpleStringParams(scimSchema.StringParams{
+						Description: optional.NewString("The displayName of the User's manager."),
+						Mutability:  scimSchema.AttributeMutabilityReadOnly(),
+						Name:        "displayName",
+					}),
+				},
+			}),
+		},
+	}
+}
+
+// validateResourceTypes checks that the endpoints and names of resourceTypes are set and unique, that endpoints are a
+// single path segment such as "/Users" and that every resource type uses schemas among the given ones.
+func validateResourceTypes(resourceTypes []scim.ResourceType, schemas ...scimSchema.Schema) error {
+	known := make(map[string]bool, len(schemas))
+	for _, s := range schemas {
+		known[s.ID] = true
+	}
+
+	endpoints := make(map[string]string, len(resourceTypes))
+	names := make(map[string]bool, len(resourceTypes))
+	for _, rt := range resourceTypes {
+		// the library sets meta.resourceType of the served resources to the name
+		if rt.Name == "" {
+			return fmt.Errorf("resource type with endpoint %q has no name", rt.Endpoint)
+		}
+		if !strings.HasPrefix(rt.Endpoint, "/") || len(rt.Endpoint) == 1 || strings.Contains(rt.Endpoint[1:], "/") {
+			return fmt.Errorf("resource type %s has invalid endpoint %q, expected a single path segment such as \"/Users\"", rt.Name, rt.Endpoint)
+		}
+		if other, ok := endpoints[strings.ToLower(rt.Endpoint)]; ok {
+			return fmt.Errorf("resource types %s and %s have the same endpoint %s", other, rt.Name, rt.Endpoint)
+		}
+		endpoints[strings.ToLower(rt.Endpoint)] = rt.Name
+		if names[rt.Name] {
+			return fmt.Errorf("resource type %s is declared twice", rt.Name)
+		}
+		names[rt.Name] = true
+
+		if rt.Handler == nil {
+			return fmt.Errorf("resource type %s has no handler", rt.Name)
+		}
+		if !known[rt.Schema.ID] {
+			return fmt.Errorf("resource type %s uses unknown schema %q", rt.Name, rt.Schema.ID)
+		}
+		for _, extension := range rt.SchemaExtensions {
+			if !known[extension.Schema.ID] {
+				return fmt.Errorf("resource type %s uses unknown schema extension %q", rt.Name, extension.Schema.ID)
+			}
+		}
+	}
+	return nil
+}
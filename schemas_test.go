@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elimity-com/scim"
+	scimSchema "github.com/elimity-com/scim/schema"
+	"github.com/wilkermichael/scim-prototype/handler"
+)
+
+const enterpriseUserURN = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+func TestEnterpriseUserExtension(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+	id := createUser(t, server, `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User", "`+enterpriseUserURN+`"],
+		"userName": "bjensen",
+		"`+enterpriseUserURN+`": {
+			"employeeNumber": "701984",
+			"department": "Tour Operations",
+			"manager": {"value": "26118915"}
+		}
+	}`)
+
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Users/"+id, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	enterprise, ok := decodeJSON(t, b)[enterpriseUserURN].(map[string]interface{})
+	if !ok {
+		t.Fatalf("got no %s attributes: %s", enterpriseUserURN, b)
+	}
+	if enterprise["employeeNumber"] != "701984" || enterprise["department"] != "Tour Operations" {
+		t.Errorf("got enterprise attributes %v", enterprise)
+	}
+	if manager, _ := enterprise["manager"].(map[string]interface{}); manager["value"] != "26118915" {
+		t.Errorf("got manager %v, want 26118915", enterprise["manager"])
+	}
+}
+
+func TestSchemasEndpoint(t *testing.T) {
+	server := startServer(t, testConfig(t), testLogger())
+
+	resp, b := do(t, server, http.MethodGet, "/scim/v2/Schemas/"+scimSchema.UserSchema, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	user := decodeJSON(t, b)
+	if user["id"] != scimSchema.UserSchema || user["name"] != "User" {
+		t.Errorf("got id %v and name %v, want %s and User", user["id"], user["name"], scimSchema.UserSchema)
+	}
+	if meta, _ := user["meta"].(map[string]interface{}); meta["resourceType"] != "Schema" || meta["location"] != "Schemas/"+scimSchema.UserSchema {
+		t.Errorf("got meta %v", user["meta"])
+	}
+
+	attributes := make(map[string]map[string]interface{})
+	for _, a := range user["attributes"].([]interface{}) {
+		attribute := a.(map[string]interface{})
+		attributes[attribute["name"].(string)] = attribute
+	}
+	for _, attr := range userSchema().Attributes {
+		if _, ok := attributes[attr.Name()]; !ok {
+			t.Errorf("got no attribute %s", attr.Name())
+		}
+	}
+	if userName := attributes["userName"]; userName["required"] != true || userName["uniqueness"] != "server" {
+		t.Errorf("got userName %v, want it required and unique", userName)
+	}
+	if password := attributes["password"]; password["mutability"] != "writeOnly" || password["returned"] != "never" {
+		t.Errorf("got password %v, want it writeOnly and never returned", password)
+	}
+	var subAttributes []string
+	for _, a := range attributes["name"]["subAttributes"].([]interface{}) {
+		subAttributes = append(subAttributes, a.(map[string]interface{})["name"].(string))
+	}
+	if !strings.Contains(strings.Join(subAttributes, ","), "givenName") {
+		t.Errorf("got name sub-attributes %v, want givenName", subAttributes)
+	}
+
+	if resp, b := do(t, server, http.MethodGet, "/scim/v2/Schemas/"+enterpriseUserURN, ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET the enterprise extension: got status %d, want %d: %s", resp.StatusCode, http.StatusOK, b)
+	}
+	if resp, _ := do(t, server, http.MethodGet, "/scim/v2/Schemas/urn:example:unknown", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET an unknown schema: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestValidateResourceTypes(t *testing.T) {
+	users := handler.NewSchemaResourceHandler(testLogger(), "User", handler.NewMemoryStore(), userSchema(), 100)
+	groups := handler.NewSchemaResourceHandler(testLogger(), "Group", handler.NewMemoryStore(), groupSchema(), 100)
+	resourceType := func(name, endpoint string, s scimSchema.Schema, h scim.ResourceHandler) scim.ResourceType {
+		return scim.ResourceType{Name: name, Endpoint: endpoint, Schema: s, Handler: h}
+	}
+
+	tests := []struct {
+		name          string
+		resourceTypes []scim.ResourceType
+		wantErr       string
+	}{
+		{"valid", []scim.ResourceType{
+			resourceType("User", "/Users", userSchema(), users),
+			resourceType("Group", "/Groups", groupSchema(), groups),
+		}, ""},
+		{"duplicate endpoint", []scim.ResourceType{
+			resourceType("User", "/Users", userSchema(), users),
+			resourceType("Group", "/users", groupSchema(), groups),
+		}, "same endpoint"},
+		{"duplicate name", []scim.ResourceType{
+			resourceType("User", "/Users", userSchema(), users),
+			resourceType("User", "/People", userSchema(), users),
+		}, "declared twice"},
+		{"no leading slash", []scim.ResourceType{resourceType("User", "Users", userSchema(), users)}, "invalid endpoint"},
+		{"root", []scim.ResourceType{resourceType("User", "/", userSchema(), users)}, "invalid endpoint"},
+		{"nested", []scim.ResourceType{resourceType("User", "/v2/Users", userSchema(), users)}, "invalid endpoint"},
+		{"no name", []scim.ResourceType{resourceType("", "/Users", userSchema(), users)}, "no name"},
+		{"no handler", []scim.ResourceType{resourceType("User", "/Users", userSchema(), nil)}, "no handler"},
+		{"unknown schema", []scim.ResourceType{
+			resourceType("User", "/Users", scimSchema.Schema{ID: "urn:example:User"}, users),
+		}, "unknown schema"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateResourceTypes(test.resourceTypes, userSchema(), groupSchema())
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certReloader serves a certificate pair that is reloaded from disk on SIGHUP, so renewed certificates are picked up
+// without restarting the server or dropping connections.
+type certReloader struct {
+	certPath, keyPath string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the certificate pair at the given paths.
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	c := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the certificate pair from disk, the current certificate is kept if that fails.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reloadOnSIGHUP reloads the certificate pair whenever the process receives SIGHUP.
+func (c *certReloader) reloadOnSIGHUP(logger *logrus.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := c.reload(); err != nil {
+				logger.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+				continue
+			}
+			logger.Infof("Reloaded TLS certificate %s", c.certPath)
+		}
+	}()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1 with the given serial number and its key to dir, and
+// returns their paths.
+func writeCert(t *testing.T, dir string, serial int64) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "scim test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certPath, keyPath = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+// servedSerial connects to server with a new connection and returns the serial number of the certificate it serves.
+func servedSerial(t *testing.T, server *httptest.Server) int64 {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCert(t, dir, 1)
+	certs, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	router, closeStores, err := newServer(testConfig(t), testLogger(), prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	defer closeStores()
+	// serve with the TLS config of main, httptest.Server.StartTLS would add its own certificate
+	server := httptest.NewUnstartedServer(router)
+	server.Listener = tls.NewListener(server.Listener, &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate})
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + server.Listener.Addr().String() + "/scim/v2/Users")
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Fatalf("GET over TLS: got status %d and connection state %v", resp.StatusCode, resp.TLS)
+	}
+	if got := servedSerial(t, server); got != 1 {
+		t.Fatalf("got certificate %d, want 1", got)
+	}
+
+	writeCert(t, dir, 2)
+	if err := certs.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := servedSerial(t, server); got != 2 {
+		t.Errorf("after reload: got certificate %d, want 2", got)
+	}
+
+	// a broken pair keeps the current certificate
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.reload(); err == nil {
+		t.Error("reload of a broken key: got no error")
+	}
+	if got := servedSerial(t, server); got != 2 {
+		t.Errorf("after a failed reload: got certificate %d, want 2", got)
+	}
+
+	writeCert(t, dir, 3)
+	certs.reloadOnSIGHUP(testLogger())
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("failed to send SIGHUP: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, server) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("after SIGHUP: the certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}